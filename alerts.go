@@ -26,6 +26,11 @@ type AlertConfig struct {
 	CheckInterval    time.Duration // How often to check
 	Cooldown         time.Duration // Minimum time between alerts
 
+	// Per-app anomaly detection
+	AppBaselineDays int     // Trailing days each app's failure rate is compared against
+	AppMinInstalls  int     // Minimum finished installs (current and baseline) per app
+	AppZThreshold   float64 // z-score at which an app's failure rate counts as a jump
+
 	// Weekly Report settings
 	WeeklyReportEnabled bool         // Enable weekly summary reports
 	WeeklyReportDay     time.Weekday // Day to send report (0=Sunday, 1=Monday, etc.)
@@ -48,6 +53,7 @@ type WeeklyReportData struct {
 	ComparedToPrev   WeekComparison
 	OsDistribution   map[string]int
 	TypeDistribution map[string]int
+	Resources        []ResourceRecommendation
 }
 
 // AppStat represents statistics for a single app
@@ -69,9 +75,10 @@ type WeekComparison struct {
 type Alerter struct {
 	cfg              AlertConfig
 	lastAlertAt      time.Time
+	lastAppAlertAt   map[string]time.Time
 	lastWeeklyReport time.Time
 	mu               sync.Mutex
-	pb               *CHClient
+	pb               Store
 	lastStats        alertStats
 	alertHistory     []AlertEvent
 }
@@ -86,16 +93,18 @@ type alertStats struct {
 type AlertEvent struct {
 	Timestamp   time.Time `json:"timestamp"`
 	Type        string    `json:"type"`
+	App         string    `json:"app,omitempty"`
 	Message     string    `json:"message"`
 	FailureRate float64   `json:"failure_rate,omitempty"`
 }
 
 // NewAlerter creates a new alerter instance
-func NewAlerter(cfg AlertConfig, pb *CHClient) *Alerter {
+func NewAlerter(cfg AlertConfig, pb Store) *Alerter {
 	return &Alerter{
-		cfg:          cfg,
-		pb:           pb,
-		alertHistory: make([]AlertEvent, 0),
+		cfg:            cfg,
+		pb:             pb,
+		lastAppAlertAt: make(map[string]time.Time),
+		alertHistory:   make([]AlertEvent, 0),
 	}
 }
 
@@ -112,7 +121,8 @@ func (a *Alerter) Start() {
 	}
 
 	go a.monitorLoop()
-	log.Printf("INFO: alert monitoring started (threshold: %.1f%%, interval: %v)", a.cfg.FailureThreshold, a.cfg.CheckInterval)
+	log.Printf("INFO: alert monitoring started (threshold: %.1f%%, per-app z >= %.1f vs. %d-day baseline, interval: %v)",
+		a.cfg.FailureThreshold, a.cfg.AppZThreshold, a.cfg.AppBaselineDays, a.cfg.CheckInterval)
 
 	// Start weekly report scheduler if enabled
 	if a.cfg.WeeklyReportEnabled {
@@ -134,26 +144,28 @@ func (a *Alerter) checkAndAlert() {
 	ctx, cancel := newTimeoutContext(10 * time.Second)
 	defer cancel()
 
-	// Fetch last hour's data
-	data, err := a.pb.FetchDashboardData(ctx, 1, "ProxmoxVE", "")
+	// Fetch today's data per hour (the same window as the dashboard's days=1)
+	since := chSinceTime(1)
+	hours, err := a.pb.FetchHourlyStats(ctx, since, "ProxmoxVE", "")
 	if err != nil {
 		log.Printf("WARN: alert check failed: %v", err)
 		return
 	}
 
-	// Calculate current failure rate
-	total := data.SuccessCount + data.FailedCount
-	if total < 10 {
-		// Not enough data to determine rate
-		return
-	}
-
-	failureRate := float64(data.FailedCount) / float64(total) * 100
+	// Calculate current failure rate (needs enough data to determine a rate)
+	success, failed := sumHourly(hours, since)
+	total := success + failed
+	if total >= 10 {
+		failureRate := float64(failed) / float64(total) * 100
 
-	// Check if we should alert
-	if failureRate >= a.cfg.FailureThreshold {
-		a.maybeSendAlert(failureRate, data.FailedCount, total)
+		// Check if we should alert
+		if failureRate >= a.cfg.FailureThreshold {
+			a.maybeSendAlert(failureRate, failed, total)
+		}
 	}
+
+	// A single broken script can hide behind a healthy global rate
+	a.checkAppAnomalies(ctx)
 }
 
 func (a *Alerter) maybeSendAlert(rate float64, failed, total int) {
@@ -498,6 +510,16 @@ func (a *Alerter) fetchWeeklyReportData(ctx context.Context) (*WeeklyReportData,
 		}
 	}
 
+	// Resource recommendations (30 days, a single week has too few installs per bucket)
+	if res, err := a.pb.FetchResourceStats(ctx, 30, "ProxmoxVE", "", ""); err != nil {
+		log.Printf("WARN: could not fetch resource recommendations: %v", err)
+	} else {
+		report.Resources = res.Recommendations
+		if len(report.Resources) > 10 {
+			report.Resources = report.Resources[:10]
+		}
+	}
+
 	return report, nil
 }
 
@@ -707,6 +729,31 @@ func (a *Alerter) generateWeeklyReportHTML(data *WeeklyReportData) string {
 </tr>
 `)
 
+	// Resource Recommendations
+	if len(data.Resources) > 0 {
+		b.WriteString(`<tr>
+<td style="padding:0 40px 24px;">
+<h2 style="margin:0 0 16px;font-size:16px;color:#1e293b;border-bottom:2px solid #e2e8f0;padding-bottom:8px;">🧮 Resource Recommendations (30 days)</h2>
+<table width="100%" cellpadding="0" cellspacing="0" style="font-size:14px;">
+`)
+		for i, rec := range data.Resources {
+			bgColor := "#ffffff"
+			if i%2 == 0 {
+				bgColor = "#f8fafc"
+			}
+			b.WriteString(fmt.Sprintf(`<tr style="background:%s;">
+<td style="padding:12px 16px;border-radius:4px 0 0 4px;">
+<span style="font-weight:500;color:#1e293b;">%s</span>
+</td>
+<td style="padding:12px 16px;text-align:right;border-radius:0 4px 4px 0;color:#64748b;">%s</td>
+</tr>`, bgColor, rec.App, resourceRecommendationText(rec)))
+		}
+		b.WriteString(`</table>
+</td>
+</tr>
+`)
+	}
+
 	// Type Distribution
 	if len(data.TypeDistribution) > 0 {
 		b.WriteString(`<tr>
@@ -852,6 +899,15 @@ func (a *Alerter) generateWeeklyReportEmail(data *WeeklyReportData) string {
 	}
 	b.WriteString("\n")
 
+	if len(data.Resources) > 0 {
+		b.WriteString("RESOURCE RECOMMENDATIONS (30 DAYS)\n")
+		b.WriteString("----------------------------------\n")
+		for _, rec := range data.Resources {
+			b.WriteString(fmt.Sprintf("%-25s %s\n", rec.App, resourceRecommendationText(rec)))
+		}
+		b.WriteString("\n")
+	}
+
 	b.WriteString("---\n")
 	b.WriteString(fmt.Sprintf("Generated: %s\n", time.Now().Format("Jan 02, 2006 15:04 MST")))
 	b.WriteString("This is an automated report from the telemetry service.\n")
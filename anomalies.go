@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Per-app failure anomalies ----------
+// The global failure-rate alert cannot see a single broken script while the
+// rest are healthy. Each app's failure rate over the last 24 hours is compared
+// against its own trailing baseline (the preceding AppBaselineDays) with a
+// two-proportion z-test; apps whose rate jumps significantly are reported
+// together with the exit code and error category behind the jump.
+
+const (
+	// appAnomalyWindow is the "current" window that is compared to the baseline.
+	appAnomalyWindow = 24 * time.Hour
+	// appAnomalyMinFailed is the minimum number of failures in the current
+	// window; a lone failure of a rarely failing app is not a jump.
+	appAnomalyMinFailed = 3
+	// appAnomalyMinIncrease is the minimum increase of the failure rate in
+	// percentage points.
+	appAnomalyMinIncrease = 10.0
+)
+
+// AppFailureWindow holds the finished installs (success/failed, user aborts
+// excluded) of one app in the current window and in the baseline before it.
+type AppFailureWindow struct {
+	App         string
+	Success     int
+	Failed      int
+	BaseSuccess int
+	BaseFailed  int
+	TopExitCode int
+	TopCategory string
+}
+
+// AppAnomaly is an app whose failure rate jumped against its baseline.
+type AppAnomaly struct {
+	App           string  `json:"app"`
+	Total         int     `json:"total"`
+	Failed        int     `json:"failed"`
+	FailureRate   float64 `json:"failure_rate"`
+	BaselineTotal int     `json:"baseline_total"`
+	BaselineRate  float64 `json:"baseline_rate"`
+	ZScore        float64 `json:"z_score"`
+	TopExitCode   int     `json:"top_exit_code"`
+	TopCategory   string  `json:"top_category"`
+}
+
+// detectAppAnomalies returns the apps whose current failure rate is
+// significantly above their baseline, highest z-score first. Both windows need
+// at least minInstalls finished installs.
+func detectAppAnomalies(windows []AppFailureWindow, minInstalls int, zThreshold float64) []AppAnomaly {
+	var out []AppAnomaly
+	for _, w := range windows {
+		n := w.Success + w.Failed
+		nb := w.BaseSuccess + w.BaseFailed
+		if n < minInstalls || nb < minInstalls || w.Failed < appAnomalyMinFailed {
+			continue
+		}
+		rate := float64(w.Failed) / float64(n) * 100
+		baseRate := float64(w.BaseFailed) / float64(nb) * 100
+		if rate-baseRate < appAnomalyMinIncrease {
+			continue
+		}
+		z := proportionZ(w.BaseFailed, nb, w.Failed, n)
+		if z < zThreshold {
+			continue
+		}
+		out = append(out, AppAnomaly{
+			App:           w.App,
+			Total:         n,
+			Failed:        w.Failed,
+			FailureRate:   rate,
+			BaselineTotal: nb,
+			BaselineRate:  baseRate,
+			ZScore:        z,
+			TopExitCode:   w.TopExitCode,
+			TopCategory:   w.TopCategory,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ZScore > out[j].ZScore })
+	return out
+}
+
+// checkAppAnomalies runs the per-app detection and mails the apps that are not
+// in their cooldown.
+func (a *Alerter) checkAppAnomalies(ctx context.Context) {
+	windows, err := a.pb.FetchAppFailureWindows(ctx, "ProxmoxVE", appAnomalyWindow, a.cfg.AppBaselineDays, a.cfg.AppMinInstalls)
+	if err != nil {
+		log.Printf("WARN: per-app alert check failed: %v", err)
+		return
+	}
+	anomalies := detectAppAnomalies(windows, a.cfg.AppMinInstalls, a.cfg.AppZThreshold)
+	if len(anomalies) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var fresh []AppAnomaly
+	for _, an := range anomalies {
+		if time.Since(a.lastAppAlertAt[an.App]) >= a.cfg.Cooldown {
+			fresh = append(fresh, an)
+		}
+	}
+	if len(fresh) == 0 {
+		return
+	}
+
+	names := make([]string, len(fresh))
+	var b strings.Builder
+	b.WriteString("ProxmoxVE Helper Scripts - Telemetry Alert\n\n")
+	b.WriteString("⚠️ Failure rate of individual scripts jumped above their baseline!\n\n")
+	for i, an := range fresh {
+		names[i] = an.App
+		b.WriteString(fmt.Sprintf("%s\n", an.App))
+		b.WriteString(fmt.Sprintf("- Failure Rate (last 24h): %.1f%% (%d/%d)\n", an.FailureRate, an.Failed, an.Total))
+		b.WriteString(fmt.Sprintf("- Baseline (%d days): %.1f%% of %d installs\n", a.cfg.AppBaselineDays, an.BaselineRate, an.BaselineTotal))
+		b.WriteString(fmt.Sprintf("- z-score: %.1f\n", an.ZScore))
+		b.WriteString(fmt.Sprintf("- Top Exit Code: %d (%s)\n", an.TopExitCode, getExitCodeDescription(an.TopExitCode)))
+		b.WriteString(fmt.Sprintf("- Top Category: %s\n\n", an.TopCategory))
+	}
+	b.WriteString(fmt.Sprintf("Time: %s\n\n", time.Now().Format(time.RFC1123)))
+	b.WriteString("Please check the dashboard for more details.\n\n")
+	b.WriteString("---\nThis is an automated alert from the telemetry service.\n")
+
+	subject := fmt.Sprintf("[ProxmoxVED Alert] Failure spike: %s", strings.Join(names, ", "))
+	if err := a.sendEmail(subject, b.String()); err != nil {
+		log.Printf("ERROR: failed to send per-app alert email: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, an := range fresh {
+		a.lastAppAlertAt[an.App] = now
+		a.alertHistory = append(a.alertHistory, AlertEvent{
+			Timestamp: now,
+			Type:      "app_failure_anomaly",
+			App:       an.App,
+			Message: fmt.Sprintf("%s failure rate %.1f%% vs. baseline %.1f%% (z=%.1f, exit code %d, %s)",
+				an.App, an.FailureRate, an.BaselineRate, an.ZScore, an.TopExitCode, an.TopCategory),
+			FailureRate: an.FailureRate,
+		})
+	}
+	if len(a.alertHistory) > 100 {
+		a.alertHistory = a.alertHistory[len(a.alertHistory)-100:]
+	}
+
+	log.Printf("ALERT: sent per-app failure alert (%s)", strings.Join(names, ", "))
+}
+
+// ══════════════════════════════════════════════════════════════
+//  APP FAILURE WINDOWS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchAppFailureWindows(ctx context.Context, repoSource string, window time.Duration, baselineDays, minInstalls int) ([]AppFailureWindow, error) {
+	now := time.Now().UTC()
+	recent := now.Add(-window)
+	since := recent.AddDate(0, 0, -baselineDays)
+
+	w, wArgs := chWhere(0, repoSource, "",
+		"created >= ?",
+		"(status = 'success' OR (status = 'failed' AND error_category != 'user_aborted'))")
+	args := []interface{}{recent, recent, recent, recent, recent, recent}
+	args = append(args, wArgs...)
+	args = append(args, since, minInstalls)
+
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT nsapp,
+			countIf(created >= ? AND status = 'success') s,
+			countIf(created >= ? AND status = 'failed') f,
+			countIf(created < ? AND status = 'success') bs,
+			countIf(created < ? AND status = 'failed') bf,
+			topKIf(1)(exit_code, created >= ? AND status = 'failed'),
+			topKIf(1)(error_category, created >= ? AND status = 'failed')
+		FROM telemetry_db.telemetry WHERE %s
+		GROUP BY nsapp
+		HAVING s + f >= ?`, w), args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH app failure windows: %w", err)
+	}
+	defer rows.Close()
+
+	var out []AppFailureWindow
+	for rows.Next() {
+		var aw AppFailureWindow
+		var s, f, bs, bf uint64
+		var codes []int16
+		var cats []string
+		if err := rows.Scan(&aw.App, &s, &f, &bs, &bf, &codes, &cats); err != nil {
+			log.Printf("[CH] app failure window scan: %v", err)
+			continue
+		}
+		aw.Success, aw.Failed, aw.BaseSuccess, aw.BaseFailed = int(s), int(f), int(bs), int(bf)
+		if len(codes) > 0 {
+			aw.TopExitCode = int(codes[0])
+		}
+		if len(cats) > 0 {
+			aw.TopCategory = cats[0]
+		}
+		out = append(out, aw)
+	}
+	return out, rows.Err()
+}
+
+// ══════════════════════════════════════════════════════════════
+//  APP FAILURE WINDOWS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchAppFailureWindows(ctx context.Context, repoSource string, window time.Duration, baselineDays, minInstalls int) ([]AppFailureWindow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	recent := time.Now().UTC().Add(-window)
+	since := recent.AddDate(0, 0, -baselineDays)
+
+	type acc struct {
+		w     AppFailureWindow
+		codes map[string]int
+		cats  map[string]int
+	}
+	apps := make(map[string]*acc)
+	for _, r := range m.rows {
+		if r.Created.Before(since) || !memRepoMatch(r, repoSource) {
+			continue
+		}
+		failed := r.Status == "failed" && r.ErrorCategory != "user_aborted"
+		if r.Status != "success" && !failed {
+			continue
+		}
+		g, ok := apps[r.NSAPP]
+		if !ok {
+			g = &acc{w: AppFailureWindow{App: r.NSAPP}, codes: make(map[string]int), cats: make(map[string]int)}
+			apps[r.NSAPP] = g
+		}
+		switch {
+		case !r.Created.Before(recent) && failed:
+			g.w.Failed++
+			g.codes[strconv.Itoa(r.ExitCode)]++
+			g.cats[r.ErrorCategory]++
+		case !r.Created.Before(recent):
+			g.w.Success++
+		case failed:
+			g.w.BaseFailed++
+		default:
+			g.w.BaseSuccess++
+		}
+	}
+
+	var out []AppFailureWindow
+	for _, g := range apps {
+		if g.w.Success+g.w.Failed < minInstalls {
+			continue
+		}
+		if top := memTop(g.codes, 1); len(top) > 0 {
+			g.w.TopExitCode, _ = strconv.Atoi(top[0].Key)
+		}
+		if top := memTop(g.cats, 1); len(top) > 0 {
+			g.w.TopCategory = top[0].Key
+		}
+		out = append(out, g.w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].App < out[j].App })
+	return out, nil
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Per-application drill-down ----------
+// GET /api/apps/{nsapp} answers "how is <script> doing?" in one call: daily
+// outcome series, exit codes and error categories, OS/PVE breakdowns, install
+// duration distribution, method and ct_type splits, and recent failures.
+// Counts come from mv_daily_stats / mv_daily_errors; breakdowns the views do not
+// carry per app are computed from the raw table.
+
+// AppDetail is the response of /api/apps/{nsapp}.
+type AppDetail struct {
+	App                string            `json:"app"`
+	Type               string            `json:"type"`
+	Days               int               `json:"days"`
+	TotalInstalls      int               `json:"total_installs"`
+	SuccessCount       int               `json:"success_count"`
+	FailedCount        int               `json:"failed_count"`
+	AbortedCount       int               `json:"aborted_count"`
+	SuccessRate        float64           `json:"success_rate"`
+	AvgInstallDuration float64           `json:"avg_install_duration"` // seconds
+	Daily              []AppDailyStat    `json:"daily"`
+	ExitCodes          []ExitCodeStat    `json:"exit_codes"`
+	ErrorCategories    []ErrorCatCount   `json:"error_categories"`
+	OsVersions         []OsVersionCount  `json:"os_versions"`
+	PveVersions        []PveCount        `json:"pve_versions"`
+	Durations          []DurationBucket  `json:"durations"`
+	Methods            []MethodCount     `json:"methods"`
+	CTTypes            []CTTypeCount     `json:"ct_types"`
+	RecentFailures     []TelemetryRecord `json:"recent_failures"`
+}
+
+type AppDailyStat struct {
+	Date    string `json:"date"`
+	Success int    `json:"success"`
+	Failed  int    `json:"failed"`
+	Aborted int    `json:"aborted"`
+}
+
+type OsVersionCount struct {
+	Os      string `json:"os"`
+	Version string `json:"version"`
+	Count   int    `json:"count"`
+}
+
+type DurationBucket struct {
+	Label string `json:"label"`
+	Min   int    `json:"min"` // seconds, inclusive
+	Max   int    `json:"max"` // seconds, exclusive (0 = open-ended)
+	Count int    `json:"count"`
+}
+
+type CTTypeCount struct {
+	CTType int    `json:"ct_type"`
+	Label  string `json:"label"`
+	Count  int    `json:"count"`
+}
+
+// appDurationBounds are the upper bounds (seconds) of the duration histogram.
+var appDurationBounds = []int{60, 120, 300, 600, 1200, 1800, 3600}
+
+// newDurationBuckets returns the empty duration histogram.
+func newDurationBuckets() []DurationBucket {
+	out := make([]DurationBucket, 0, len(appDurationBounds)+1)
+	lo := 0
+	for _, hi := range appDurationBounds {
+		out = append(out, DurationBucket{Label: fmt.Sprintf("%d-%dm", lo/60, hi/60), Min: lo, Max: hi})
+		lo = hi
+	}
+	return append(out, DurationBucket{Label: fmt.Sprintf(">%dm", lo/60), Min: lo})
+}
+
+// durationBucketIndex returns the histogram slot for a duration in seconds.
+func durationBucketIndex(sec int) int {
+	return sort.SearchInts(appDurationBounds, sec+1)
+}
+
+// durationBucketSQL is the ClickHouse expression equivalent to durationBucketIndex.
+func durationBucketSQL() string {
+	parts := make([]string, 0, 2*len(appDurationBounds)+1)
+	for i, hi := range appDurationBounds {
+		parts = append(parts, fmt.Sprintf("install_duration < %d", hi), fmt.Sprint(i))
+	}
+	parts = append(parts, fmt.Sprint(len(appDurationBounds)))
+	return "multiIf(" + strings.Join(parts, ", ") + ")"
+}
+
+func ctTypeLabel(ct int) string {
+	switch ct {
+	case 0:
+		return "privileged"
+	case 1:
+		return "unprivileged"
+	}
+	return fmt.Sprintf("ct_type %d", ct)
+}
+
+// buildAppDaily fills a dense per-day series (oldest first).
+func buildAppDaily(success, failed, aborted map[string]int, days int) []AppDailyStat {
+	out := make([]AppDailyStat, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		date := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
+		out = append(out, AppDailyStat{
+			Date:    date,
+			Success: success[date],
+			Failed:  failed[date],
+			Aborted: aborted[date],
+		})
+	}
+	return out
+}
+
+// finish derives the rates once the counts are filled in.
+func (d *AppDetail) finish() {
+	if d.SuccessCount+d.FailedCount > 0 {
+		d.SuccessRate = float64(d.SuccessCount) / float64(d.SuccessCount+d.FailedCount) * 100
+	}
+	totalErrors := 0
+	for _, e := range d.ExitCodes {
+		totalErrors += e.Count
+	}
+	for i := range d.ExitCodes {
+		if totalErrors > 0 {
+			d.ExitCodes[i].Percentage = float64(d.ExitCodes[i].Count) / float64(totalErrors) * 100
+		}
+	}
+}
+
+// ══════════════════════════════════════════════════════════════
+//  APP DETAIL (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchAppDetail(ctx context.Context, nsapp string, days int, repoSource, repoSlug string) (*AppDetail, error) {
+	data := &AppDetail{App: nsapp, Days: days}
+	rawAgg := repoSlug != ""
+
+	mw, ma := chMVWhere(days, repoSource)
+	mw += " AND nsapp = ?"
+	ma = append(ma, nsapp)
+	rw, ra := chWhere(days, repoSource, repoSlug, "nsapp = ?")
+	ra = append(ra, nsapp)
+	tw, ta := chWhere(days, repoSource, repoSlug, "nsapp = ?", "status IN ('success','failed','aborted','unknown')")
+	ta = append(ta, nsapp)
+
+	// ── Daily outcome series (also yields the totals) ──
+	query := fmt.Sprintf(`
+		SELECT toString(day) d, any(type), sum(total), sum(success), sum(failed), sum(aborted)
+		FROM telemetry_db.mv_daily_stats WHERE %s
+		GROUP BY d`, mw)
+	args := ma
+	if rawAgg {
+		query = fmt.Sprintf(`
+			SELECT toString(toDate(created)) d, any(type), count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY d`, rw)
+		args = ra
+	}
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH app daily: %w", err)
+	}
+	sMap, fMap, aMap := make(map[string]int), make(map[string]int), make(map[string]int)
+	for rows.Next() {
+		var day, typ string
+		var t, s, f, a uint64
+		if rows.Scan(&day, &typ, &t, &s, &f, &a) != nil {
+			continue
+		}
+		if typ != "" {
+			data.Type = typ
+		}
+		data.TotalInstalls += int(t)
+		data.SuccessCount += int(s)
+		data.FailedCount += int(f)
+		data.AbortedCount += int(a)
+		sMap[day], fMap[day], aMap[day] = int(s), int(f), int(a)
+	}
+	rows.Close()
+	seriesDays := days
+	if seriesDays <= 0 {
+		seriesDays = 365
+	}
+	data.Daily = buildAppDaily(sMap, fMap, aMap, seriesDays)
+
+	// ── Exit codes and error categories (real failures only) ──
+	errQuery := fmt.Sprintf(`
+		SELECT exit_code, error_category, sum(cnt) c
+		FROM telemetry_db.mv_daily_errors WHERE %s
+		GROUP BY exit_code, error_category`, mw)
+	errArgs := ma
+	if rawAgg {
+		ew, ea := chWhere(days, repoSource, repoSlug, "nsapp = ?", "status='failed'", "error_category!='user_aborted'", "exit_code!=0")
+		errQuery = fmt.Sprintf(`
+			SELECT exit_code, error_category, count() c
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY exit_code, error_category`, ew)
+		errArgs = append(ea, nsapp)
+	}
+	if rows, err := ch.db.QueryContext(ctx, errQuery, errArgs...); err == nil {
+		codes := make(map[int]int)
+		cats := make(map[string]int)
+		for rows.Next() {
+			var code int16
+			var cat string
+			var c uint64
+			if rows.Scan(&code, &cat, &c) == nil {
+				codes[int(code)] += int(c)
+				if cat != "" {
+					cats[cat] += int(c)
+				}
+			}
+		}
+		rows.Close()
+		data.ExitCodes, data.ErrorCategories = appErrorBreakdown(codes, cats)
+	}
+
+	// ── OS/version breakdown ──
+	if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT os_type, os_version, count() c FROM telemetry_db.telemetry
+		WHERE %s AND os_type != ''
+		GROUP BY os_type, os_version ORDER BY c DESC LIMIT 20`, tw), ta...); err == nil {
+		for rows.Next() {
+			var o OsVersionCount
+			var c uint64
+			if rows.Scan(&o.Os, &o.Version, &c) == nil {
+				o.Count = int(c)
+				data.OsVersions = append(data.OsVersions, o)
+			}
+		}
+		rows.Close()
+	}
+
+	// ── PVE versions ──
+	if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT pve_version, count() c FROM telemetry_db.telemetry
+		WHERE %s AND pve_version != ''
+		GROUP BY pve_version ORDER BY c DESC LIMIT 15`, tw), ta...); err == nil {
+		for rows.Next() {
+			var p PveCount
+			var c uint64
+			if rows.Scan(&p.Version, &c) == nil {
+				p.Count = int(c)
+				data.PveVersions = append(data.PveVersions, p)
+			}
+		}
+		rows.Close()
+	}
+
+	// ── Install duration distribution ──
+	data.Durations = newDurationBuckets()
+	if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s b, count(), sum(install_duration) FROM telemetry_db.telemetry
+		WHERE %s AND install_duration > 0
+		GROUP BY b`, durationBucketSQL(), tw), ta...); err == nil {
+		var n, sum uint64
+		for rows.Next() {
+			var b uint8
+			var c, s uint64
+			if rows.Scan(&b, &c, &s) == nil && int(b) < len(data.Durations) {
+				data.Durations[b].Count = int(c)
+				n += c
+				sum += s
+			}
+		}
+		rows.Close()
+		if n > 0 {
+			data.AvgInstallDuration = float64(sum) / float64(n)
+		}
+	}
+
+	// ── Method and ct_type splits ──
+	if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT method, count() c FROM telemetry_db.telemetry
+		WHERE %s AND method != ''
+		GROUP BY method ORDER BY c DESC LIMIT 10`, tw), ta...); err == nil {
+		for rows.Next() {
+			var m MethodCount
+			var c uint64
+			if rows.Scan(&m.Method, &c) == nil {
+				m.Count = int(c)
+				data.Methods = append(data.Methods, m)
+			}
+		}
+		rows.Close()
+	}
+	if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT ct_type, count() c FROM telemetry_db.telemetry
+		WHERE %s AND type IN ('lxc','turnkey')
+		GROUP BY ct_type ORDER BY ct_type`, tw), ta...); err == nil {
+		for rows.Next() {
+			var ct uint8
+			var c uint64
+			if rows.Scan(&ct, &c) == nil {
+				data.CTTypes = append(data.CTTypes, CTTypeCount{CTType: int(ct), Label: ctTypeLabel(int(ct)), Count: int(c)})
+			}
+		}
+		rows.Close()
+	}
+
+	// ── Recent failure samples ──
+	fw, fa := chWhere(days, repoSource, repoSlug, "nsapp = ?", "status = 'failed'", "error_category != 'user_aborted'")
+	fa = append(fa, nsapp)
+	if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM telemetry_db.telemetry
+		WHERE %s
+		ORDER BY created DESC LIMIT 20`, recordSelectCols, fw), fa...); err == nil {
+		data.RecentFailures = scanRecords(rows)
+		rows.Close()
+	}
+
+	data.finish()
+	return data, nil
+}
+
+// appErrorBreakdown turns exit-code and category counts into the sorted
+// response lists (top 15 exit codes, all categories).
+func appErrorBreakdown(codes map[int]int, cats map[string]int) ([]ExitCodeStat, []ErrorCatCount) {
+	var exitCodes []ExitCodeStat
+	for code, c := range codes {
+		exitCodes = append(exitCodes, ExitCodeStat{
+			ExitCode:    code,
+			Count:       c,
+			Description: getExitCodeDescription(code),
+			Category:    getExitCodeCategory(code),
+		})
+	}
+	sort.Slice(exitCodes, func(i, j int) bool {
+		if exitCodes[i].Count != exitCodes[j].Count {
+			return exitCodes[i].Count > exitCodes[j].Count
+		}
+		return exitCodes[i].ExitCode < exitCodes[j].ExitCode
+	})
+	if len(exitCodes) > 15 {
+		exitCodes = exitCodes[:15]
+	}
+
+	var categories []ErrorCatCount
+	for cat, c := range cats {
+		categories = append(categories, ErrorCatCount{Category: cat, Count: c})
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Count != categories[j].Count {
+			return categories[i].Count > categories[j].Count
+		}
+		return categories[i].Category < categories[j].Category
+	})
+	return exitCodes, categories
+}
+
+// ══════════════════════════════════════════════════════════════
+//  APP DETAIL (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchAppDetail(ctx context.Context, nsapp string, days int, repoSource, repoSlug string) (*AppDetail, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data := &AppDetail{App: nsapp, Days: days, Durations: newDurationBuckets()}
+	sMap, fMap, aMap := make(map[string]int), make(map[string]int), make(map[string]int)
+	codes := make(map[int]int)
+	cats := make(map[string]int)
+	oses := make(map[string]int)
+	pves := make(map[string]int)
+	methods := make(map[string]int)
+	ctTypes := make(map[int]int)
+	var durSum, durCnt int
+	var failures []memRow
+
+	for _, r := range m.rows {
+		if r.NSAPP != nsapp || !memMatch(r, days, repoSource, repoSlug) {
+			continue
+		}
+		day := memDay(r.Created)
+		if r.Type != "" {
+			data.Type = r.Type
+		}
+		data.TotalInstalls++
+		switch r.Status {
+		case "success":
+			data.SuccessCount++
+			sMap[day]++
+		case "failed":
+			data.FailedCount++
+			fMap[day]++
+		case "aborted":
+			data.AbortedCount++
+			aMap[day]++
+		}
+		if memRealError(r) {
+			codes[r.ExitCode]++
+			if r.ErrorCategory != "" {
+				cats[r.ErrorCategory]++
+			}
+		}
+		if r.Status == "failed" && r.ErrorCategory != "user_aborted" {
+			failures = append(failures, r)
+		}
+		if !isTerminalStatus(r.Status) {
+			continue
+		}
+		if r.OsType != "" {
+			oses[r.OsType+"|"+r.OsVersion]++
+		}
+		if r.PveVer != "" {
+			pves[r.PveVer]++
+		}
+		if r.Method != "" {
+			methods[r.Method]++
+		}
+		if r.Type == "lxc" || r.Type == "turnkey" {
+			ctTypes[r.CTType]++
+		}
+		if r.InstallDuration > 0 {
+			data.Durations[durationBucketIndex(r.InstallDuration)].Count++
+			durSum += r.InstallDuration
+			durCnt++
+		}
+	}
+
+	seriesDays := days
+	if seriesDays <= 0 {
+		seriesDays = 365
+	}
+	data.Daily = buildAppDaily(sMap, fMap, aMap, seriesDays)
+	data.ExitCodes, data.ErrorCategories = appErrorBreakdown(codes, cats)
+	for _, c := range memTop(oses, 20) {
+		parts := strings.SplitN(c.Key, "|", 2)
+		data.OsVersions = append(data.OsVersions, OsVersionCount{Os: parts[0], Version: parts[1], Count: c.Count})
+	}
+	for _, c := range memTop(pves, 15) {
+		data.PveVersions = append(data.PveVersions, PveCount{Version: c.Key, Count: c.Count})
+	}
+	for _, c := range memTop(methods, 10) {
+		data.Methods = append(data.Methods, MethodCount{Method: c.Key, Count: c.Count})
+	}
+	for ct := 0; ct <= 2; ct++ {
+		if c := ctTypes[ct]; c > 0 {
+			data.CTTypes = append(data.CTTypes, CTTypeCount{CTType: ct, Label: ctTypeLabel(ct), Count: c})
+		}
+	}
+	if durCnt > 0 {
+		data.AvgInstallDuration = float64(durSum) / float64(durCnt)
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool { return failures[i].Created.After(failures[j].Created) })
+	if len(failures) > 20 {
+		failures = failures[:20]
+	}
+	for _, r := range failures {
+		data.RecentFailures = append(data.RecentFailures, TelemetryRecord{TelemetryOut: r.TelemetryOut, Created: memCreatedString(r.Created)})
+	}
+
+	data.finish()
+	return data, nil
+}
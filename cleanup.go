@@ -19,11 +19,11 @@ type CleanupConfig struct {
 // Cleaner handles cleanup of stuck installations
 type Cleaner struct {
 	cfg CleanupConfig
-	ch  *CHClient
+	ch  Store
 }
 
 // NewCleaner creates a new cleaner instance
-func NewCleaner(cfg CleanupConfig, ch *CHClient) *Cleaner {
+func NewCleaner(cfg CleanupConfig, ch Store) *Cleaner {
 	return &Cleaner{
 		cfg: cfg,
 		ch:  ch,
@@ -167,21 +167,5 @@ func (c *Cleaner) GetRetentionStats(ctx context.Context) (eligible int, oldestDa
 		return 0, "", nil
 	}
 
-	cutoff := time.Now().AddDate(0, 0, -c.cfg.RetentionDays)
-	var cnt uint64
-	if err := c.ch.db.QueryRowContext(ctx,
-		"SELECT count() FROM telemetry_db.telemetry WHERE created < ?", cutoff,
-	).Scan(&cnt); err != nil {
-		return 0, "", err
-	}
-
-	var oldest string
-	_ = c.ch.db.QueryRowContext(ctx,
-		"SELECT toString(min(created)) FROM telemetry_db.telemetry",
-	).Scan(&oldest)
-	if len(oldest) >= 10 {
-		oldest = oldest[:10]
-	}
-
-	return int(cnt), oldest, nil
+	return c.ch.RetentionStats(ctx, c.cfg.RetentionDays)
 }
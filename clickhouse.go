@@ -85,7 +85,7 @@ func (ch *CHClient) migrate() {
 			type             String,
 			status           String,
 			method           String,
-			created          DateTime64(3),
+			created          DateTime64(3) DEFAULT now64(3),
 			core_count       UInt8,
 			ct_type          UInt8,
 			disk_size        UInt32,
@@ -107,7 +107,10 @@ func (ch *CHClient) migrate() {
 			gpu_passthrough  String,
 			ram_speed        String,
 			install_duration UInt32,
-			has_arm          UInt8
+			has_arm          UInt8,
+			script_version   String,
+			script_commit    String,
+			error_fingerprint String
 		) ENGINE = MergeTree()
 		ORDER BY (created, nsapp)
 		PARTITION BY toYYYYMM(created)`,
@@ -207,6 +210,100 @@ func (ch *CHClient) migrate() {
 		WHERE pve_version != '' AND status IN ('success','failed','aborted','unknown')
 		GROUP BY day, repo_source, pve_version`,
 
+		// ── Materialized view: daily outcomes per app and PVE release ──
+		// pve_version is normalized to major.minor so patch releases share a
+		// column of the compatibility matrix.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_daily_app_pve (
+			day         Date,
+			nsapp       String,
+			col         String,
+			repo_source String,
+			total       UInt64,
+			success     UInt64,
+			failed      UInt64,
+			aborted     UInt64
+		) ENGINE = SummingMergeTree()
+		ORDER BY (day, nsapp, col, repo_source)
+		PARTITION BY toYYYYMM(day)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_daily_app_pve_view
+		TO telemetry_db.mv_daily_app_pve AS
+		SELECT
+			toDate(created) AS day,
+			nsapp,
+			extract(pve_version, '[0-9]+[.][0-9]+') AS col,
+			repo_source,
+			count()                   AS total,
+			countIf(status='success') AS success,
+			countIf(status='failed')  AS failed,
+			countIf(status='aborted') AS aborted
+		FROM telemetry_db.telemetry
+		WHERE extract(pve_version, '[0-9]+[.][0-9]+') != ''
+		  AND status IN ('success','failed','aborted','unknown')
+		GROUP BY day, nsapp, col, repo_source`,
+
+		// ── Materialized view: daily outcomes per app and guest OS/version ──
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_daily_app_os (
+			day         Date,
+			nsapp       String,
+			col         String,
+			repo_source String,
+			total       UInt64,
+			success     UInt64,
+			failed      UInt64,
+			aborted     UInt64
+		) ENGINE = SummingMergeTree()
+		ORDER BY (day, nsapp, col, repo_source)
+		PARTITION BY toYYYYMM(day)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_daily_app_os_view
+		TO telemetry_db.mv_daily_app_os AS
+		SELECT
+			toDate(created) AS day,
+			nsapp,
+			trim(concat(os_type, ' ', os_version)) AS col,
+			repo_source,
+			count()                   AS total,
+			countIf(status='success') AS success,
+			countIf(status='failed')  AS failed,
+			countIf(status='aborted') AS aborted
+		FROM telemetry_db.telemetry
+		WHERE os_type != '' AND status IN ('success','failed','aborted','unknown')
+		GROUP BY day, nsapp, col, repo_source`,
+
+		// ── Materialized view: daily outcomes per app and install method ──
+		// error_category is part of the key so failures can be broken down by
+		// category per method (it is empty for successful installs).
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_daily_app_method (
+			day            Date,
+			nsapp          String,
+			method         String,
+			error_category String,
+			repo_source    String,
+			total          UInt64,
+			success        UInt64,
+			failed         UInt64,
+			aborted        UInt64
+		) ENGINE = SummingMergeTree()
+		ORDER BY (day, nsapp, method, error_category, repo_source)
+		PARTITION BY toYYYYMM(day)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_daily_app_method_view
+		TO telemetry_db.mv_daily_app_method AS
+		SELECT
+			toDate(created) AS day,
+			nsapp,
+			method,
+			error_category,
+			repo_source,
+			count()                   AS total,
+			countIf(status='success') AS success,
+			countIf(status='failed')  AS failed,
+			countIf(status='aborted') AS aborted
+		FROM telemetry_db.telemetry
+		WHERE method != '' AND status IN ('success','failed','aborted','unknown')
+		GROUP BY day, nsapp, method, error_category, repo_source`,
+
 		// ── Materialized view: daily errors (excludes user_aborted) ──
 		// Pre-aggregates real failures per (date, app, exit_code, error_category).
 		// user_aborted (SIGHUP/SIGINT from closed terminals) is noise, not errors.
@@ -237,6 +334,112 @@ func (ch *CHClient) migrate() {
 		  AND error_category != 'user_aborted'
 		  AND exit_code != 0
 		GROUP BY day, nsapp, type, exit_code, error_category, repo_source`,
+
+		// ── Materialized views: hourly stats and errors ──
+		// Same counts as mv_daily_stats / mv_daily_errors per hour, for windows
+		// of up to 48 hours. Only needed for recent data, so rows expire.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_hourly_stats (
+			hour             DateTime,
+			nsapp            String,
+			type             String,
+			repo_source      String,
+			total            UInt64,
+			success          UInt64,
+			failed           UInt64,
+			aborted          UInt64,
+			installing       UInt64
+		) ENGINE = SummingMergeTree()
+		ORDER BY (hour, nsapp, type, repo_source)
+		PARTITION BY toYYYYMMDD(hour)
+		TTL hour + INTERVAL 7 DAY`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_hourly_stats_view
+		TO telemetry_db.mv_hourly_stats AS
+		SELECT
+			toStartOfHour(created) AS hour,
+			nsapp,
+			type,
+			repo_source,
+			count()                        AS total,
+			countIf(status='success')      AS success,
+			countIf(status='failed')       AS failed,
+			countIf(status='aborted')      AS aborted,
+			countIf(status IN ('installing','validation','configuring')) AS installing
+		FROM telemetry_db.telemetry
+		GROUP BY hour, nsapp, type, repo_source`,
+
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_hourly_errors (
+			hour           DateTime,
+			nsapp          String,
+			type           String,
+			exit_code      Int16,
+			error_category String,
+			repo_source    String,
+			cnt            UInt64
+		) ENGINE = SummingMergeTree()
+		ORDER BY (hour, nsapp, exit_code, error_category, repo_source)
+		PARTITION BY toYYYYMMDD(hour)
+		TTL hour + INTERVAL 7 DAY`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_hourly_errors_view
+		TO telemetry_db.mv_hourly_errors AS
+		SELECT
+			toStartOfHour(created) AS hour,
+			nsapp,
+			type,
+			exit_code,
+			error_category,
+			repo_source,
+			count() AS cnt
+		FROM telemetry_db.telemetry
+		WHERE status = 'failed'
+		  AND error_category != 'user_aborted'
+		  AND exit_code != 0
+		GROUP BY hour, nsapp, type, exit_code, error_category, repo_source`,
+
+		// ── Materialized view: install duration quantiles ──
+		// Quantile states of successful install durations per (day, app, type,
+		// os_type, repo_source); merged at query time for any window.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_daily_duration (
+			day         Date,
+			nsapp       String,
+			type        String,
+			os_type     String,
+			repo_source String,
+			cnt         SimpleAggregateFunction(sum, UInt64),
+			dur         AggregateFunction(quantiles(0.5, 0.9, 0.99), UInt32)
+		) ENGINE = AggregatingMergeTree()
+		ORDER BY (day, nsapp, type, os_type, repo_source)
+		PARTITION BY toYYYYMM(day)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_daily_duration_view
+		TO telemetry_db.mv_daily_duration AS
+		SELECT
+			toDate(created) AS day,
+			nsapp,
+			type,
+			os_type,
+			repo_source,
+			toUInt64(count()) AS cnt,
+			quantilesState(0.5, 0.9, 0.99)(install_duration) AS dur
+		FROM telemetry_db.telemetry
+		WHERE status = 'success' AND install_duration > 0
+		GROUP BY day, nsapp, type, os_type, repo_source`,
+
+		// ── Dead letters: payloads rejected at decode/validate or lost after all
+		// write retries. Kept for 30 days so they can be inspected and replayed.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.dead_letters (
+			id               String,
+			created          DateTime64(3) DEFAULT now64(3),
+			stage            LowCardinality(String),
+			reason           String,
+			nsapp            String,
+			execution_id     String,
+			body             String
+		) ENGINE = MergeTree()
+		ORDER BY (created, stage)
+		PARTITION BY toYYYYMM(created)
+		TTL toDateTime(created) + INTERVAL 30 DAY`,
 	}
 
 	for _, s := range stmts {
@@ -249,6 +452,10 @@ func (ch *CHClient) migrate() {
 	alters := []string{
 		`ALTER TABLE telemetry_db.telemetry ADD COLUMN IF NOT EXISTS repo_slug String`,
 		`ALTER TABLE telemetry_db.telemetry ADD COLUMN IF NOT EXISTS has_arm UInt8`,
+		`ALTER TABLE telemetry_db.telemetry ADD COLUMN IF NOT EXISTS script_version String`,
+		`ALTER TABLE telemetry_db.telemetry ADD COLUMN IF NOT EXISTS script_commit String`,
+		`ALTER TABLE telemetry_db.telemetry ADD COLUMN IF NOT EXISTS error_fingerprint String`,
+		`ALTER TABLE telemetry_db.telemetry MODIFY COLUMN created DateTime64(3) DEFAULT now64(3)`,
 	}
 	for _, s := range alters {
 		if _, err := ch.db.ExecContext(ctx, s); err != nil {
@@ -256,6 +463,132 @@ func (ch *CHClient) migrate() {
 		}
 	}
 
+	// Views over columns added by the ALTERs above (created afterwards so they
+	// also succeed on tables that predate those columns).
+	views := []string{
+		// ── Materialized view: daily outcomes per script revision ──
+		// Only rows that report a script_version or script_commit.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_daily_revision (
+			day            Date,
+			nsapp          String,
+			type           String,
+			script_version String,
+			script_commit  String,
+			repo_source    String,
+			total          UInt64,
+			success        UInt64,
+			failed         UInt64,
+			aborted        UInt64
+		) ENGINE = SummingMergeTree()
+		ORDER BY (day, nsapp, type, script_version, script_commit, repo_source)
+		PARTITION BY toYYYYMM(day)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_daily_revision_view
+		TO telemetry_db.mv_daily_revision AS
+		SELECT
+			toDate(created) AS day,
+			nsapp,
+			type,
+			script_version,
+			script_commit,
+			repo_source,
+			count()                   AS total,
+			countIf(status='success') AS success,
+			countIf(status='failed')  AS failed,
+			countIf(status='aborted') AS aborted
+		FROM telemetry_db.telemetry
+		WHERE script_version != '' OR script_commit != ''
+		GROUP BY day, nsapp, type, script_version, script_commit, repo_source`,
+
+		// ── Materialized view: first and last install per repo_slug ──
+		// One row per slug (after merges) so fork first/last seen never
+		// scans the raw table.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_repo_slug_seen (
+			repo_slug   String,
+			repo_source String,
+			first_seen  SimpleAggregateFunction(min, DateTime64(3)),
+			last_seen   SimpleAggregateFunction(max, DateTime64(3))
+		) ENGINE = AggregatingMergeTree()
+		ORDER BY (repo_slug, repo_source)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_repo_slug_seen_view
+		TO telemetry_db.mv_repo_slug_seen AS
+		SELECT repo_slug, repo_source,
+			min(created) AS first_seen,
+			max(created) AS last_seen
+		FROM telemetry_db.telemetry
+		WHERE repo_slug != ''
+		GROUP BY repo_slug, repo_source`,
+
+		// ── Materialized view: first appearance of each script revision ──
+		// One row per revision (after merges), without TTL or day split, so
+		// revisions can be ordered by when they were introduced whatever the
+		// window.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_revision_first_seen (
+			nsapp          String,
+			type           String,
+			script_version String,
+			script_commit  String,
+			repo_source    String,
+			first_seen     SimpleAggregateFunction(min, DateTime64(3))
+		) ENGINE = AggregatingMergeTree()
+		ORDER BY (nsapp, type, script_version, script_commit, repo_source)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_revision_first_seen_view
+		TO telemetry_db.mv_revision_first_seen AS
+		SELECT nsapp, type, script_version, script_commit, repo_source,
+			min(created) AS first_seen
+		FROM telemetry_db.telemetry
+		WHERE script_version != '' OR script_commit != ''
+		GROUP BY nsapp, type, script_version, script_commit, repo_source`,
+
+		// ── Materialized view: daily failures per error fingerprint ──
+		// Same filter as mv_daily_errors. Only rows ingested after
+		// error_fingerprint was introduced carry a fingerprint, so there is no
+		// backfill.
+		`CREATE TABLE IF NOT EXISTS telemetry_db.mv_daily_error_fingerprint (
+			day               Date,
+			nsapp             String,
+			type              String,
+			exit_code         Int16,
+			error_category    String,
+			error_fingerprint String,
+			repo_source       String,
+			cnt               SimpleAggregateFunction(sum, UInt64),
+			first_seen        SimpleAggregateFunction(min, DateTime64(3)),
+			last_seen         SimpleAggregateFunction(max, DateTime64(3)),
+			sample            SimpleAggregateFunction(anyLast, String)
+		) ENGINE = AggregatingMergeTree()
+		ORDER BY (day, error_fingerprint, nsapp, type, exit_code, error_category, repo_source)
+		PARTITION BY toYYYYMM(day)`,
+
+		`CREATE MATERIALIZED VIEW IF NOT EXISTS telemetry_db.mv_daily_error_fingerprint_view
+		TO telemetry_db.mv_daily_error_fingerprint AS
+		SELECT
+			toDate(created) AS day,
+			nsapp,
+			type,
+			exit_code,
+			error_category,
+			error_fingerprint,
+			repo_source,
+			toUInt64(count()) AS cnt,
+			min(created)      AS first_seen,
+			max(created)      AS last_seen,
+			anyLast(substring(error, greatest(1, length(error) - 2047))) AS sample
+		FROM telemetry_db.telemetry
+		WHERE status = 'failed'
+		  AND error_category != 'user_aborted'
+		  AND exit_code != 0
+		  AND error_fingerprint != ''
+		GROUP BY day, nsapp, type, exit_code, error_category, error_fingerprint, repo_source`,
+	}
+	for _, s := range views {
+		if _, err := ch.db.ExecContext(ctx, s); err != nil {
+			log.Printf("[CH-MIGRATE] %v", err)
+		}
+	}
+
 	// Backfill materialized views from existing data if they're empty
 	var mvCount uint64
 	_ = ch.db.QueryRowContext(ctx, "SELECT count() FROM telemetry_db.mv_daily_stats").Scan(&mvCount)
@@ -319,9 +652,112 @@ func (ch *CHClient) migrate() {
 			}
 		}
 	}
+
+	ch.backfillIfEmpty(ctx, "mv_daily_duration",
+		"status = 'success' AND install_duration > 0",
+		`INSERT INTO telemetry_db.mv_daily_duration
+		SELECT toDate(created), nsapp, type, os_type, repo_source,
+			toUInt64(count()), quantilesState(0.5, 0.9, 0.99)(install_duration)
+		FROM telemetry_db.telemetry
+		WHERE status = 'success' AND install_duration > 0
+		GROUP BY toDate(created), nsapp, type, os_type, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_daily_app_pve",
+		"pve_version != '' AND status IN ('success','failed','aborted','unknown')",
+		`INSERT INTO telemetry_db.mv_daily_app_pve
+		SELECT toDate(created), nsapp, extract(pve_version, '[0-9]+[.][0-9]+') AS col, repo_source,
+			count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+		FROM telemetry_db.telemetry
+		WHERE col != '' AND status IN ('success','failed','aborted','unknown')
+		GROUP BY toDate(created), nsapp, col, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_daily_app_os",
+		"os_type != '' AND status IN ('success','failed','aborted','unknown')",
+		`INSERT INTO telemetry_db.mv_daily_app_os
+		SELECT toDate(created), nsapp, trim(concat(os_type, ' ', os_version)) AS col, repo_source,
+			count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+		FROM telemetry_db.telemetry
+		WHERE os_type != '' AND status IN ('success','failed','aborted','unknown')
+		GROUP BY toDate(created), nsapp, col, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_daily_app_method",
+		"method != '' AND status IN ('success','failed','aborted','unknown')",
+		`INSERT INTO telemetry_db.mv_daily_app_method
+		SELECT toDate(created), nsapp, method, error_category, repo_source,
+			count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+		FROM telemetry_db.telemetry
+		WHERE method != '' AND status IN ('success','failed','aborted','unknown')
+		GROUP BY toDate(created), nsapp, method, error_category, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_daily_revision",
+		"script_version != '' OR script_commit != ''",
+		`INSERT INTO telemetry_db.mv_daily_revision
+		SELECT toDate(created), nsapp, type, script_version, script_commit, repo_source,
+			count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+		FROM telemetry_db.telemetry
+		WHERE script_version != '' OR script_commit != ''
+		GROUP BY toDate(created), nsapp, type, script_version, script_commit, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_repo_slug_seen",
+		"repo_slug != ''",
+		`INSERT INTO telemetry_db.mv_repo_slug_seen
+		SELECT repo_slug, repo_source, min(created), max(created)
+		FROM telemetry_db.telemetry
+		WHERE repo_slug != ''
+		GROUP BY repo_slug, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_revision_first_seen",
+		"script_version != '' OR script_commit != ''",
+		`INSERT INTO telemetry_db.mv_revision_first_seen
+		SELECT nsapp, type, script_version, script_commit, repo_source, min(created)
+		FROM telemetry_db.telemetry
+		WHERE script_version != '' OR script_commit != ''
+		GROUP BY nsapp, type, script_version, script_commit, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_hourly_stats",
+		"created >= now() - INTERVAL 7 DAY",
+		`INSERT INTO telemetry_db.mv_hourly_stats
+		SELECT toStartOfHour(created), nsapp, type, repo_source,
+			count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted'),
+			countIf(status IN ('installing','validation','configuring'))
+		FROM telemetry_db.telemetry
+		WHERE created >= now() - INTERVAL 7 DAY
+		GROUP BY toStartOfHour(created), nsapp, type, repo_source`)
+
+	ch.backfillIfEmpty(ctx, "mv_hourly_errors",
+		"created >= now() - INTERVAL 7 DAY AND status = 'failed' AND error_category != 'user_aborted' AND exit_code != 0",
+		`INSERT INTO telemetry_db.mv_hourly_errors
+		SELECT toStartOfHour(created), nsapp, type, exit_code, error_category, repo_source, count()
+		FROM telemetry_db.telemetry
+		WHERE created >= now() - INTERVAL 7 DAY
+		  AND status = 'failed' AND error_category != 'user_aborted' AND exit_code != 0
+		GROUP BY toStartOfHour(created), nsapp, type, exit_code, error_category, repo_source`)
+
 	log.Println("[CH-MIGRATE] Schema ready")
 }
 
+// backfillIfEmpty populates a materialized view target table from the raw
+// table when it is empty and matching source rows exist (views added after
+// the initial deploy only see new inserts).
+func (ch *CHClient) backfillIfEmpty(ctx context.Context, table, srcWhere, insert string) {
+	var mvCount uint64
+	_ = ch.db.QueryRowContext(ctx, "SELECT count() FROM telemetry_db."+table).Scan(&mvCount)
+	if mvCount > 0 {
+		return
+	}
+	var srcCount uint64
+	_ = ch.db.QueryRowContext(ctx, "SELECT count() FROM telemetry_db.telemetry WHERE "+srcWhere).Scan(&srcCount)
+	if srcCount == 0 {
+		return
+	}
+	log.Printf("[CH-MIGRATE] Backfilling %s from %d rows...", table, srcCount)
+	if _, err := ch.db.ExecContext(ctx, insert); err != nil {
+		log.Printf("[CH-MIGRATE] %s backfill error: %v", table, err)
+		return
+	}
+	log.Printf("[CH-MIGRATE] %s backfill complete", table)
+}
+
 func (ch *CHClient) Close() error                   { return ch.db.Close() }
 func (ch *CHClient) Ping(ctx context.Context) error { return ch.db.PingContext(ctx) }
 
@@ -337,22 +773,24 @@ func generateRecordID() string {
 
 func (ch *CHClient) InsertTelemetry(ctx context.Context, p TelemetryOut) error {
 	const q = `INSERT INTO telemetry_db.telemetry (
-		id, nsapp, type, status, method, created,
+		id, nsapp, type, status, method,
 		core_count, ct_type, disk_size, ram_size,
 		exit_code, error, error_category,
 		os_type, os_version, pve_version,
 		random_id, execution_id, repo_source, repo_slug,
 		cpu_vendor, cpu_model,
 		gpu_vendor, gpu_model, gpu_passthrough,
-		ram_speed, install_duration, has_arm
+		ram_speed, install_duration, has_arm,
+		script_version, script_commit, error_fingerprint
 	) VALUES (
-		?, ?, ?, ?, ?, now64(3),
+		?, ?, ?, ?, ?,
 		?, ?, ?, ?,
 		?, ?, ?,
 		?, ?, ?,
 		?, ?, ?, ?,
 		?, ?,
 		?, ?, ?,
+		?, ?, ?,
 		?, ?, ?
 	)`
 	_, err := ch.db.ExecContext(ctx, q,
@@ -364,10 +802,66 @@ func (ch *CHClient) InsertTelemetry(ctx context.Context, p TelemetryOut) error {
 		p.CPUVendor, p.CPUModel,
 		p.GPUVendor, p.GPUModel, p.GPUPassthrough,
 		p.RAMSpeed, uint32(p.InstallDuration), boolToUint8(p.HasArm),
+		p.ScriptVersion, p.ScriptCommit, p.ErrorFingerprint,
 	)
 	return err
 }
 
+// InsertTelemetryBatch writes several rows with a single INSERT. The statement
+// is prepared inside a transaction so clickhouse-go sends all rows as one block
+// instead of one INSERT (and one part) per event. Like InsertTelemetry it leaves
+// created to the column default, so both use the server clock.
+func (ch *CHClient) InsertTelemetryBatch(ctx context.Context, rows []TelemetryOut) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if len(rows) == 1 {
+		return ch.InsertTelemetry(ctx, rows[0])
+	}
+
+	tx, err := ch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO telemetry_db.telemetry (
+		id, nsapp, type, status, method,
+		core_count, ct_type, disk_size, ram_size,
+		exit_code, error, error_category,
+		os_type, os_version, pve_version,
+		random_id, execution_id, repo_source, repo_slug,
+		cpu_vendor, cpu_model,
+		gpu_vendor, gpu_model, gpu_passthrough,
+		ram_speed, install_duration, has_arm,
+		script_version, script_commit, error_fingerprint
+	)`)
+	if err != nil {
+		return fmt.Errorf("prepare batch: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range rows {
+		if _, err := stmt.ExecContext(ctx,
+			generateRecordID(), p.NSAPP, p.Type, p.Status, p.Method,
+			uint8(p.CoreCount), uint8(p.CTType), uint32(p.DiskSize), uint32(p.RAMSize),
+			int16(p.ExitCode), p.Error, p.ErrorCategory,
+			p.OsType, p.OsVersion, p.PveVer,
+			p.RandomID, p.ExecutionID, p.RepoSource, p.RepoSlug,
+			p.CPUVendor, p.CPUModel,
+			p.GPUVendor, p.GPUModel, p.GPUPassthrough,
+			p.RAMSpeed, uint32(p.InstallDuration), boolToUint8(p.HasArm),
+			p.ScriptVersion, p.ScriptCommit, p.ErrorFingerprint,
+		); err != nil {
+			return fmt.Errorf("append batch row: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("send batch: %w", err)
+	}
+	return nil
+}
+
 // boolToUint8 maps a Go bool to ClickHouse's UInt8 (0/1) representation.
 func boolToUint8(b bool) uint8 {
 	if b {
@@ -390,6 +884,30 @@ func (ch *CHClient) HasTerminalExecutionID(ctx context.Context, eid string) (boo
 	return cnt > 0, err
 }
 
+// HasTerminalExecutionIDs is the batched form of HasTerminalExecutionID: it
+// returns the subset of eids that already have a terminal-status row.
+func (ch *CHClient) HasTerminalExecutionIDs(ctx context.Context, eids []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	if len(eids) == 0 {
+		return found, nil
+	}
+	rows, err := ch.db.QueryContext(ctx,
+		"SELECT DISTINCT execution_id FROM telemetry_db.telemetry WHERE has(?, execution_id) AND status IN ('success','failed','aborted','unknown')", eids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var eid string
+		if err := rows.Scan(&eid); err != nil {
+			return nil, err
+		}
+		found[eid] = true
+	}
+	return found, rows.Err()
+}
+
 func (ch *CHClient) HasExecutionID(ctx context.Context, eid string) (bool, error) {
 	var cnt uint64
 	err := ch.db.QueryRowContext(ctx,
@@ -494,6 +1012,7 @@ func scanRecords(rows *sql.Rows) []TelemetryRecord {
 			&r.CPUVendor, &r.CPUModel,
 			&r.GPUVendor, &r.GPUModel, &r.GPUPassthrough,
 			&r.RAMSpeed, &installDur, &hasArm,
+			&r.ScriptVersion, &r.ScriptCommit, &r.ErrorFingerprint,
 			&r.Created,
 		)
 		if err != nil {
@@ -521,6 +1040,7 @@ const recordSelectCols = `nsapp, type, status, method,
 	cpu_vendor, cpu_model,
 	gpu_vendor, gpu_model, gpu_passthrough,
 	ram_speed, install_duration, has_arm,
+	script_version, script_commit, error_fingerprint,
 	toString(created)`
 
 // ══════════════════════════════════════════════════════════════
@@ -838,8 +1358,16 @@ func (ch *CHClient) FetchDashboardData(ctx context.Context, days int, repoSource
 		data.FailedApps = buildFailedApps(appTotal, appFailed, 16, minInstalls)
 	}
 
-	// ── 10. Daily stats ──
-	if rawAgg {
+	// ── 10. Daily stats (per hour for windows of up to 48 hours) ──
+	data.Interval = statsInterval(days)
+	if useHourly(days) {
+		since := chSinceTime(days)
+		if hs, err := ch.FetchHourlyStats(ctx, since, repoSource, repoSlug); err == nil {
+			data.DailyStats = buildHourlyStats(hs, since)
+		} else {
+			log.Printf("[CH] dashboard hourly stats: %v", err)
+		}
+	} else if rawAgg {
 		if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
 			SELECT toString(toDate(created)) d, countIf(status='success') s, countIf(status='failed') f
 			FROM telemetry_db.telemetry WHERE %s
@@ -1016,74 +1544,15 @@ func (ch *CHClient) FetchScriptStats(ctx context.Context, days int, repoSource s
 	}
 	defer rows.Close()
 
-	data := &ScriptAnalysisData{}
-	now := time.Now()
-	seen := make(map[string]bool)
-
+	var aggs []scriptAgg
 	for rows.Next() {
-		var nsapp, typ string
-		var total, sc, fc, ac uint64
-		if err := rows.Scan(&nsapp, &typ, &total, &sc, &fc, &ac); err != nil {
+		var a scriptAgg
+		if err := rows.Scan(&a.App, &a.Type, &a.Total, &a.Success, &a.Failed, &a.Aborted); err != nil {
 			continue
 		}
-		// Filter to known scripts if provided
-		if len(knownScripts) > 0 {
-			if _, ok := knownScripts[nsapp]; !ok {
-				continue
-			}
-		}
-		seen[nsapp] = true
-
-		// Override type from script_scripts metadata
-		if knownScripts != nil {
-			if info, ok := knownScripts[nsapp]; ok {
-				typ = info.Type
-			}
-		}
-
-		completed := sc + fc + ac
-		rate := float64(0)
-		if completed > 0 {
-			rate = float64(sc) / float64(completed) * 100
-		}
-		daysOld := 0
-		installsPerDay := float64(0)
-		if knownScripts != nil {
-			if info, ok := knownScripts[nsapp]; ok && !info.Created.IsZero() {
-				daysOld = int(now.Sub(info.Created).Hours() / 24)
-				if daysOld < 1 {
-					daysOld = 1
-				}
-				installsPerDay = float64(total) / float64(daysOld)
-			}
-		}
-
-		data.TopScripts = append(data.TopScripts, ScriptStat{
-			App: nsapp, Type: typ,
-			Total: int(total), Success: int(sc), Failed: int(fc), Aborted: int(ac),
-			SuccessRate: rate, DaysOld: daysOld, InstallsPerDay: installsPerDay,
-		})
-		data.TotalInstalls += int(total)
-	}
-
-	// Add zero-usage known scripts (30d + alltime)
-	if knownScripts != nil && (days == 0 || days >= 30) {
-		for slug, info := range knownScripts {
-			if !seen[slug] {
-				daysOld := 0
-				if !info.Created.IsZero() {
-					daysOld = int(now.Sub(info.Created).Hours() / 24)
-					if daysOld < 1 {
-						daysOld = 1
-					}
-				}
-				data.TopScripts = append(data.TopScripts, ScriptStat{
-					App: slug, Type: info.Type, DaysOld: daysOld,
-				})
-			}
-		}
+		aggs = append(aggs, a)
 	}
-	data.TotalScripts = len(data.TopScripts)
+	data := buildScriptStats(aggs, days, knownScripts)
 
 	log.Printf("[CH] Script stats: %d scripts, %d total installs (days=%d)", data.TotalScripts, data.TotalInstalls, days)
 	return data, nil
@@ -1239,8 +1708,16 @@ func (ch *CHClient) FetchErrorAnalysisData(ctx context.Context, days int, repoSo
 		}
 	}
 
-	// Error timeline
-	if rawAgg {
+	// Error timeline (per hour for windows of up to 48 hours)
+	data.Interval = statsInterval(days)
+	if useHourly(days) {
+		since := chSinceTime(days)
+		if hs, err := ch.FetchHourlyStats(ctx, since, repoSource, repoSlug); err == nil {
+			data.ErrorTimeline = buildHourlyTimeline(hs, since)
+		} else {
+			log.Printf("[CH] error timeline hourly stats: %v", err)
+		}
+	} else if rawAgg {
 		errW, errA := chWhere(days, repoSource, repoSlug, "status='failed'", "error_category!='user_aborted'", "exit_code!=0")
 		if rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
 			SELECT toString(toDate(created)) d, count() f
@@ -1563,8 +2040,8 @@ func (ch *CHClient) MarkRecordAsUnknown(ctx context.Context, record StuckRecord,
 	// Copy nsapp, type from the original row and set status=unknown.
 	_, err := ch.db.ExecContext(ctx, `
 		INSERT INTO telemetry_db.telemetry
-			(id, nsapp, type, status, error, error_category, created, execution_id, random_id, repo_source)
-		SELECT ?, nsapp, type, 'unknown', ?, 'timeout', now64(3), execution_id, random_id, repo_source
+			(id, nsapp, type, status, error, error_category, created, execution_id, random_id, repo_source, script_version, script_commit)
+		SELECT ?, nsapp, type, 'unknown', ?, 'timeout', now64(3), execution_id, random_id, repo_source, script_version, script_commit
 		FROM telemetry_db.telemetry WHERE id = ? LIMIT 1`,
 		generateRecordID(),
 		fmt.Sprintf("Installation timed out - no completion status received after %dh", stuckHours),
@@ -1580,6 +2057,28 @@ func (ch *CHClient) DeleteOldRecords(ctx context.Context, retentionDays int) err
 	return err
 }
 
+// RetentionStats returns how many records are older than retentionDays and
+// the date of the oldest record.
+func (ch *CHClient) RetentionStats(ctx context.Context, retentionDays int) (int, string, error) {
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	var cnt uint64
+	if err := ch.db.QueryRowContext(ctx,
+		"SELECT count() FROM telemetry_db.telemetry WHERE created < ?", cutoff,
+	).Scan(&cnt); err != nil {
+		return 0, "", err
+	}
+
+	var oldest string
+	_ = ch.db.QueryRowContext(ctx,
+		"SELECT toString(min(created)) FROM telemetry_db.telemetry",
+	).Scan(&oldest)
+	if len(oldest) >= 10 {
+		oldest = oldest[:10]
+	}
+
+	return int(cnt), oldest, nil
+}
+
 func (ch *CHClient) GetStuckCount(ctx context.Context, stuckHours int) (int, error) {
 	var cnt uint64
 	err := ch.db.QueryRowContext(ctx, `
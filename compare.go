@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Period-over-period comparison ----------
+// With ?compare=previous the dashboard, error and script APIs also return the
+// value of every headline metric, top app and exit code for the preceding
+// window of equal length, together with the absolute and relative change, so
+// trend arrows need no second request. The previous window is the current one
+// shifted back by its elapsed length (days=1 at 15:00 compares today's 15
+// hours with the 15 hours before midnight). It is aggregated once per (days,
+// repo, slug) and cached.
+
+// Delta is a value in the current and the previous window. ChangePercent is
+// relative to Previous (0 when Previous is 0).
+type Delta struct {
+	Current       float64 `json:"current"`
+	Previous      float64 `json:"previous"`
+	Change        float64 `json:"change"`
+	ChangePercent float64 `json:"change_percent"`
+}
+
+func newDelta(current, previous float64) Delta {
+	d := Delta{Current: current, Previous: previous, Change: current - previous}
+	if previous != 0 {
+		d.ChangePercent = d.Change / previous * 100
+	}
+	return d
+}
+
+// KeyDelta is the Delta of one top-list entry (app or exit code).
+type KeyDelta struct {
+	Key string `json:"key"`
+	Delta
+}
+
+// PeriodComparison is attached to a response when compare=previous is set.
+type PeriodComparison struct {
+	Days      int              `json:"days"`
+	Metrics   map[string]Delta `json:"metrics"`
+	TopApps   []KeyDelta       `json:"top_apps"`
+	ExitCodes []KeyDelta       `json:"exit_codes,omitempty"`
+}
+
+// PeriodAppCount holds the counts of one app in a window. Errors are failures
+// that were not aborted by the user.
+type PeriodAppCount struct {
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Aborted int `json:"aborted"`
+	Errors  int `json:"errors"`
+}
+
+// PeriodCounts holds the counts of the window preceding the requested one.
+// Errors and ExitCodes count real errors (failed, not user-aborted, exit code
+// != 0) like the error analysis does.
+type PeriodCounts struct {
+	Total     int                       `json:"total"`
+	Success   int                       `json:"success"`
+	Failed    int                       `json:"failed"`
+	Aborted   int                       `json:"aborted"`
+	Errors    int                       `json:"errors"`
+	Apps      map[string]PeriodAppCount `json:"apps"`
+	ExitCodes map[int]int               `json:"exit_codes"`
+}
+
+// add counts one app aggregate towards the totals.
+func (p *PeriodCounts) add(app string, c PeriodAppCount) {
+	p.Total += c.Total
+	p.Success += c.Success
+	p.Failed += c.Failed
+	p.Aborted += c.Aborted
+	if app != "" {
+		p.Apps[app] = c
+	}
+}
+
+func newPeriodCounts() *PeriodCounts {
+	return &PeriodCounts{Apps: make(map[string]PeriodAppCount), ExitCodes: make(map[int]int)}
+}
+
+// successRate is success/(success+failed) in percent, like the dashboard.
+func successRate(success, failed int) float64 {
+	if success+failed == 0 {
+		return 0
+	}
+	return float64(success) / float64(success+failed) * 100
+}
+
+// previousWindow returns the window [from, until) compared with the last
+// days: the current window [since, now) shifted back by its elapsed length.
+func previousWindow(days int) (from, until time.Time) {
+	until = chSinceTime(days)
+	return until.Add(-time.Since(until)), until
+}
+
+// wantsComparison reports whether the request asks for compare=previous.
+func wantsComparison(r *http.Request) bool {
+	return r.URL.Query().Get("compare") == "previous"
+}
+
+// fetchPreviousPeriod returns the counts of the window before the last days
+// (see previousWindow), cached like the responses it is compared with.
+func fetchPreviousPeriod(ctx context.Context, store Store, cache *Cache, useCache bool, days int, repoSource, repoSlug string) (*PeriodCounts, error) {
+	cacheKey := telemetryCacheKey("compare", days, repoSource, repoSlug)
+	var prev *PeriodCounts
+	if useCache && cache.Get(ctx, cacheKey, &prev) {
+		return prev, nil
+	}
+	prev, err := store.FetchPreviousPeriod(ctx, days, repoSource, repoSlug)
+	if err != nil {
+		return nil, err
+	}
+	if useCache {
+		ttl := 10 * time.Minute
+		if days > 7 {
+			ttl = time.Hour
+		}
+		_ = cache.Set(ctx, cacheKey, prev, ttl)
+	}
+	return prev, nil
+}
+
+// compareDashboard compares the headline counts and the top apps.
+func compareDashboard(days int, cur *DashboardData, prev *PeriodCounts) *PeriodComparison {
+	c := &PeriodComparison{Days: days, TopApps: []KeyDelta{}, Metrics: map[string]Delta{
+		"total_installs": newDelta(float64(cur.TotalInstalls), float64(prev.Total)),
+		"success_count":  newDelta(float64(cur.SuccessCount), float64(prev.Success)),
+		"failed_count":   newDelta(float64(cur.FailedCount), float64(prev.Failed)),
+		"aborted_count":  newDelta(float64(cur.AbortedCount), float64(prev.Aborted)),
+		"success_rate":   newDelta(cur.SuccessRate, successRate(prev.Success, prev.Failed)),
+	}}
+	for _, a := range cur.TopApps {
+		c.TopApps = append(c.TopApps, KeyDelta{Key: a.App, Delta: newDelta(float64(a.Count), float64(prev.Apps[a.App].Total))})
+	}
+	return c
+}
+
+// compareErrors compares the error totals, the failures of the top failing
+// apps and the exit codes.
+func compareErrors(days int, cur *ErrorAnalysisData, prev *PeriodCounts) *PeriodComparison {
+	prevRate := 0.0
+	if prev.Total > 0 {
+		prevRate = float64(prev.Errors) / float64(prev.Total) * 100
+	}
+	c := &PeriodComparison{Days: days, TopApps: []KeyDelta{}, ExitCodes: []KeyDelta{}, Metrics: map[string]Delta{
+		"total_installs":    newDelta(float64(cur.TotalInstalls), float64(prev.Total)),
+		"total_errors":      newDelta(float64(cur.TotalErrors), float64(prev.Errors)),
+		"overall_fail_rate": newDelta(cur.OverallFailRate, prevRate),
+	}}
+	for _, a := range cur.AppErrors {
+		c.TopApps = append(c.TopApps, KeyDelta{Key: a.App, Delta: newDelta(float64(a.FailedCount), float64(prev.Apps[a.App].Errors))})
+	}
+	for _, e := range cur.ExitCodeStats {
+		c.ExitCodes = append(c.ExitCodes, KeyDelta{Key: strconv.Itoa(e.ExitCode), Delta: newDelta(float64(e.Count), float64(prev.ExitCodes[e.ExitCode]))})
+	}
+	return c
+}
+
+// compareScripts compares the install total and the installs of the top
+// scripts.
+func compareScripts(days int, cur *ScriptAnalysisData, prev *PeriodCounts) *PeriodComparison {
+	c := &PeriodComparison{Days: days, TopApps: []KeyDelta{}, Metrics: map[string]Delta{
+		"total_installs": newDelta(float64(cur.TotalInstalls), float64(prev.Total)),
+	}}
+	for _, s := range cur.TopScripts {
+		c.TopApps = append(c.TopApps, KeyDelta{Key: s.App, Delta: newDelta(float64(s.Total), float64(prev.Apps[s.App].Total))})
+	}
+	return c
+}
+
+// ══════════════════════════════════════════════════════════════
+//  PREVIOUS PERIOD (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+// FetchPreviousPeriod reads the previous window from mv_daily_stats and
+// mv_daily_errors unless a repo_slug is given. The window rarely starts at
+// midnight; its partial first day is read from the raw table.
+func (ch *CHClient) FetchPreviousPeriod(ctx context.Context, days int, repoSource, repoSlug string) (*PeriodCounts, error) {
+	from, until := previousWindow(days)
+	p := newPeriodCounts()
+	apps := make(map[string]*PeriodAppCount)
+
+	if repoSlug != "" {
+		if err := ch.previousPeriodRaw(ctx, p, apps, from, until, repoSource, repoSlug); err != nil {
+			return nil, err
+		}
+	} else {
+		dayFrom := from.Truncate(24 * time.Hour)
+		if dayFrom.Before(from) {
+			dayFrom = dayFrom.Add(24 * time.Hour)
+			if err := ch.previousPeriodRaw(ctx, p, apps, from, dayFrom, repoSource, ""); err != nil {
+				return nil, err
+			}
+		}
+		if dayFrom.Before(until) {
+			if err := ch.previousPeriodMV(ctx, p, apps, dayFrom, until, repoSource); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for app, c := range apps {
+		p.add(app, *c)
+	}
+	return p, nil
+}
+
+// periodApp returns the counts of app, creating them on first use.
+func periodApp(apps map[string]*PeriodAppCount, app string) *PeriodAppCount {
+	c, ok := apps[app]
+	if !ok {
+		c = &PeriodAppCount{}
+		apps[app] = c
+	}
+	return c
+}
+
+// previousPeriodRaw adds the installs created in [from, until) from the raw
+// table.
+func (ch *CHClient) previousPeriodRaw(ctx context.Context, p *PeriodCounts, apps map[string]*PeriodAppCount, from, until time.Time, repoSource, repoSlug string) error {
+	w, args := chWhere(0, repoSource, repoSlug, "created >= ?", "created < ?")
+	args = append(args, from, until)
+
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT nsapp, count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted'),
+			countIf(status='failed' AND error_category!='user_aborted')
+		FROM telemetry_db.telemetry WHERE %s
+		GROUP BY nsapp`, w), args...)
+	if err != nil {
+		return fmt.Errorf("CH previous period: %w", err)
+	}
+	for rows.Next() {
+		var app string
+		var t, s, f, a, e uint64
+		if err := rows.Scan(&app, &t, &s, &f, &a, &e); err != nil {
+			log.Printf("[CH] previous period scan: %v", err)
+			continue
+		}
+		c := periodApp(apps, app)
+		c.Total += int(t)
+		c.Success += int(s)
+		c.Failed += int(f)
+		c.Aborted += int(a)
+		c.Errors += int(e)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	rows, err = ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT exit_code, count() FROM telemetry_db.telemetry
+		WHERE %s AND status='failed' AND error_category!='user_aborted' AND exit_code!=0
+		GROUP BY exit_code`, w), args...)
+	if err != nil {
+		return fmt.Errorf("CH previous period exit codes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code int16
+		var cnt uint64
+		if err := rows.Scan(&code, &cnt); err != nil {
+			log.Printf("[CH] previous period exit code scan: %v", err)
+			continue
+		}
+		p.ExitCodes[int(code)] += int(cnt)
+		p.Errors += int(cnt)
+	}
+	return rows.Err()
+}
+
+// previousPeriodMV adds the whole days [from, until) from the daily views.
+// Errors per app come from mv_daily_errors and therefore exclude exit code 0
+// (such failures are reclassified as success on ingest anyway).
+func (ch *CHClient) previousPeriodMV(ctx context.Context, p *PeriodCounts, apps map[string]*PeriodAppCount, from, until time.Time, repoSource string) error {
+	parts := []string{"day >= ?", "day < ?"}
+	args := []interface{}{from.Format("2006-01-02"), until.Format("2006-01-02")}
+	if pred, pArgs := repoSourcePred(repoSource); pred != "" {
+		parts = append(parts, pred)
+		args = append(args, pArgs...)
+	}
+	w := strings.Join(parts, " AND ")
+
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT nsapp, sum(total), sum(success), sum(failed), sum(aborted)
+		FROM telemetry_db.mv_daily_stats WHERE %s
+		GROUP BY nsapp`, w), args...)
+	if err != nil {
+		return fmt.Errorf("CH previous period: %w", err)
+	}
+	for rows.Next() {
+		var app string
+		var t, s, f, a uint64
+		if err := rows.Scan(&app, &t, &s, &f, &a); err != nil {
+			log.Printf("[CH] previous period scan: %v", err)
+			continue
+		}
+		c := periodApp(apps, app)
+		c.Total += int(t)
+		c.Success += int(s)
+		c.Failed += int(f)
+		c.Aborted += int(a)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	rows, err = ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT nsapp, exit_code, sum(cnt) FROM telemetry_db.mv_daily_errors WHERE %s
+		GROUP BY nsapp, exit_code`, w), args...)
+	if err != nil {
+		return fmt.Errorf("CH previous period exit codes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var app string
+		var code int16
+		var cnt uint64
+		if err := rows.Scan(&app, &code, &cnt); err != nil {
+			log.Printf("[CH] previous period exit code scan: %v", err)
+			continue
+		}
+		periodApp(apps, app).Errors += int(cnt)
+		p.ExitCodes[int(code)] += int(cnt)
+		p.Errors += int(cnt)
+	}
+	return rows.Err()
+}
+
+// ══════════════════════════════════════════════════════════════
+//  PREVIOUS PERIOD (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchPreviousPeriod(ctx context.Context, days int, repoSource, repoSlug string) (*PeriodCounts, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	from, until := previousWindow(days)
+	apps := make(map[string]*PeriodAppCount)
+	p := newPeriodCounts()
+	for _, r := range m.rows {
+		if r.Created.Before(from) || !r.Created.Before(until) || !memMatch(r, 0, repoSource, repoSlug) {
+			continue
+		}
+		c := periodApp(apps, r.NSAPP)
+		c.Total++
+		switch r.Status {
+		case "success":
+			c.Success++
+		case "failed":
+			c.Failed++
+			if r.ErrorCategory != "user_aborted" {
+				c.Errors++
+			}
+		case "aborted":
+			c.Aborted++
+		}
+		if memRealError(r) {
+			p.ExitCodes[r.ExitCode]++
+			p.Errors++
+		}
+	}
+	for app, c := range apps {
+		p.add(app, *c)
+	}
+	return p, nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---------- Compatibility matrices ----------
+// Outcome counts per (nsapp, environment): the Proxmox VE release or the
+// guest OS/version the script ran on. A cell is flagged when its failure rate
+// is significantly above the rest of the same app, so breakage that only
+// shows up on one release stands out within days instead of being averaged
+// away. The worst combinations across all apps are listed separately.
+
+const (
+	// compatMinSamples is the number of finished installs (success + failed)
+	// a cell and the rest of its app need before the cell can be flagged.
+	compatMinSamples = 10
+	// compatFlagZ is the z-score at which a cell is flagged.
+	compatFlagZ = 1.96
+	// compatWorstLimit is the length of the worst-combinations list.
+	compatWorstLimit = 20
+)
+
+// CompatCell holds the outcomes of one app in one environment.
+type CompatCell struct {
+	Column      string  `json:"column"`
+	Total       int     `json:"total"`
+	Success     int     `json:"success"`
+	Failed      int     `json:"failed"`
+	Aborted     int     `json:"aborted"`
+	FailureRate float64 `json:"failure_rate"`
+	ZScore      float64 `json:"z_score,omitempty"`
+	Flagged     bool    `json:"flagged"`
+}
+
+// CompatRow is one app with its cells (only environments it was installed on).
+type CompatRow struct {
+	App         string       `json:"app"`
+	Total       int          `json:"total"`
+	Success     int          `json:"success"`
+	Failed      int          `json:"failed"`
+	FailureRate float64      `json:"failure_rate"`
+	Cells       []CompatCell `json:"cells"`
+}
+
+// CompatWorst is a cell in the list of worst (app, environment) combinations.
+type CompatWorst struct {
+	App string `json:"app"`
+	CompatCell
+}
+
+// CompatMatrix is the response of the /api/compat/* endpoints.
+type CompatMatrix struct {
+	Days      int           `json:"days"`
+	Dimension string        `json:"dimension"`
+	Columns   []string      `json:"columns"`
+	Rows      []CompatRow   `json:"rows"`
+	Worst     []CompatWorst `json:"worst"`
+}
+
+// pveMinorRe extracts major.minor from a PVE version ("8.2.4", "pve-manager/8.2.4").
+var pveMinorRe = regexp.MustCompile(`\d+\.\d+`)
+
+// pveMajorMinor normalizes a PVE version to major.minor ("" if none).
+func pveMajorMinor(v string) string {
+	return pveMinorRe.FindString(v)
+}
+
+// naturalLess orders labels with embedded numbers numerically ("8.10" after "8.9").
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ai, bi := leadingNumber(a), leadingNumber(b)
+		if ai > 0 && bi > 0 {
+			na, _ := strconv.Atoi(a[:ai])
+			nb, _ := strconv.Atoi(b[:bi])
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[ai:], b[bi:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// leadingNumber returns the length of the run of digits at the start of s.
+func leadingNumber(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// buildCompatMatrix assembles the matrix from per-(app, column) cells and
+// flags cells against the rest of their app. Apps are ordered by volume and
+// capped at limit; the worst combinations (highest failure rate with at least
+// compatMinSamples finished installs) are taken from all apps.
+func buildCompatMatrix(days int, dimension string, cells map[[2]string]*CompatCell, limit int) *CompatMatrix {
+	rows := make(map[string]*CompatRow)
+	for key, c := range cells {
+		r, ok := rows[key[0]]
+		if !ok {
+			r = &CompatRow{App: key[0]}
+			rows[key[0]] = r
+		}
+		c.Column = key[1]
+		r.Total += c.Total
+		r.Success += c.Success
+		r.Failed += c.Failed
+		r.Cells = append(r.Cells, *c)
+	}
+
+	m := &CompatMatrix{Days: days, Dimension: dimension, Columns: []string{}, Rows: []CompatRow{}, Worst: []CompatWorst{}}
+	for _, r := range rows {
+		if n := r.Success + r.Failed; n > 0 {
+			r.FailureRate = float64(r.Failed) / float64(n) * 100
+		}
+		for j := range r.Cells {
+			c := &r.Cells[j]
+			n := c.Success + c.Failed
+			if n == 0 {
+				continue
+			}
+			c.FailureRate = float64(c.Failed) / float64(n) * 100
+			if n < compatMinSamples {
+				continue
+			}
+			if restN := r.Success + r.Failed - n; restN >= compatMinSamples {
+				c.ZScore = proportionZ(r.Failed-c.Failed, restN, c.Failed, n)
+				c.Flagged = c.ZScore >= compatFlagZ
+			}
+			if c.Failed > 0 {
+				m.Worst = append(m.Worst, CompatWorst{App: r.App, CompatCell: *c})
+			}
+		}
+		sort.Slice(r.Cells, func(a, b int) bool { return naturalLess(r.Cells[a].Column, r.Cells[b].Column) })
+		m.Rows = append(m.Rows, *r)
+	}
+	sort.Slice(m.Rows, func(i, j int) bool {
+		if m.Rows[i].Total != m.Rows[j].Total {
+			return m.Rows[i].Total > m.Rows[j].Total
+		}
+		return m.Rows[i].App < m.Rows[j].App
+	})
+	if limit > 0 && len(m.Rows) > limit {
+		m.Rows = m.Rows[:limit]
+	}
+	sort.Slice(m.Worst, func(i, j int) bool {
+		a, b := m.Worst[i], m.Worst[j]
+		if a.FailureRate != b.FailureRate {
+			return a.FailureRate > b.FailureRate
+		}
+		if a.Failed != b.Failed {
+			return a.Failed > b.Failed
+		}
+		return a.App+a.Column < b.App+b.Column
+	})
+	if len(m.Worst) > compatWorstLimit {
+		m.Worst = m.Worst[:compatWorstLimit]
+	}
+
+	columns := make(map[string]bool)
+	for _, r := range m.Rows {
+		for _, c := range r.Cells {
+			columns[c.Column] = true
+		}
+	}
+	for c := range columns {
+		m.Columns = append(m.Columns, c)
+	}
+	sort.Slice(m.Columns, func(i, j int) bool { return naturalLess(m.Columns[i], m.Columns[j]) })
+	return m
+}
+
+// compatDimension describes how one matrix is read: the MV with per-(day,
+// nsapp, col) counts and the equivalent expression on the raw table (used when
+// filtering by repo_slug, which the MVs don't have).
+type compatDimension struct {
+	name    string
+	mvTable string
+	rawExpr string
+}
+
+var (
+	compatPve = compatDimension{
+		name:    "pve",
+		mvTable: "mv_daily_app_pve",
+		rawExpr: "extract(pve_version, '[0-9]+[.][0-9]+')",
+	}
+	compatOs = compatDimension{
+		name:    "os",
+		mvTable: "mv_daily_app_os",
+		rawExpr: "if(os_type = '', '', trim(concat(os_type, ' ', os_version)))",
+	}
+)
+
+// osLabel is the matrix column of an OS ("debian 12", or the bare os_type
+// when no version was reported).
+func osLabel(osType, osVersion string) string {
+	if osType == "" {
+		return ""
+	}
+	return strings.TrimSpace(osType + " " + osVersion)
+}
+
+// ══════════════════════════════════════════════════════════════
+//  COMPATIBILITY MATRIX (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) fetchCompatMatrix(ctx context.Context, dim compatDimension, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error) {
+	var query string
+	var args []interface{}
+	if repoSlug != "" {
+		extras := []string{"status IN ('success','failed','aborted','unknown')"}
+		if app != "" {
+			extras = append(extras, "nsapp = ?")
+		}
+		w, a := chWhere(days, repoSource, repoSlug, extras...)
+		if app != "" {
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT nsapp, %s col,
+				count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY nsapp, col HAVING col != ''`, dim.rawExpr, w)
+		args = a
+	} else {
+		w, a := chMVWhere(days, repoSource)
+		if app != "" {
+			w += " AND nsapp = ?"
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT nsapp, col, sum(total), sum(success), sum(failed), sum(aborted)
+			FROM telemetry_db.%s WHERE %s
+			GROUP BY nsapp, col`, dim.mvTable, w)
+		args = a
+	}
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH %s matrix: %w", dim.name, err)
+	}
+	defer rows.Close()
+
+	cells := make(map[[2]string]*CompatCell)
+	for rows.Next() {
+		var nsapp, col string
+		var total, success, failed, aborted uint64
+		if err := rows.Scan(&nsapp, &col, &total, &success, &failed, &aborted); err != nil {
+			log.Printf("[CH] %s matrix scan: %v", dim.name, err)
+			continue
+		}
+		cells[[2]string{nsapp, col}] = &CompatCell{
+			Total: int(total), Success: int(success), Failed: int(failed), Aborted: int(aborted),
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildCompatMatrix(days, dim.name, cells, limit), nil
+}
+
+func (ch *CHClient) FetchPveMatrix(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error) {
+	return ch.fetchCompatMatrix(ctx, compatPve, days, repoSource, repoSlug, app, limit)
+}
+
+func (ch *CHClient) FetchOsMatrix(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error) {
+	return ch.fetchCompatMatrix(ctx, compatOs, days, repoSource, repoSlug, app, limit)
+}
+
+// ══════════════════════════════════════════════════════════════
+//  COMPATIBILITY MATRIX (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+// compatMatrix counts finished rows per (nsapp, column(row)); rows for which
+// column returns "" are skipped.
+func (m *MemStore) compatMatrix(dimension string, column func(memRow) string, days int, repoSource, repoSlug, app string, limit int) *CompatMatrix {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cells := make(map[[2]string]*CompatCell)
+	for _, r := range m.rows {
+		if !isTerminalStatus(r.Status) || !memMatch(r, days, repoSource, repoSlug) || (app != "" && r.NSAPP != app) {
+			continue
+		}
+		col := column(r)
+		if col == "" {
+			continue
+		}
+		key := [2]string{r.NSAPP, col}
+		c, ok := cells[key]
+		if !ok {
+			c = &CompatCell{}
+			cells[key] = c
+		}
+		c.Total++
+		switch r.Status {
+		case "success":
+			c.Success++
+		case "failed":
+			c.Failed++
+		case "aborted":
+			c.Aborted++
+		}
+	}
+	return buildCompatMatrix(days, dimension, cells, limit)
+}
+
+func (m *MemStore) FetchPveMatrix(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error) {
+	return m.compatMatrix(compatPve.name, func(r memRow) string { return pveMajorMinor(r.PveVer) },
+		days, repoSource, repoSlug, app, limit), nil
+}
+
+func (m *MemStore) FetchOsMatrix(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error) {
+	return m.compatMatrix(compatOs.name, func(r memRow) string { return osLabel(r.OsType, r.OsVersion) },
+		days, repoSource, repoSlug, app, limit), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestProportionZ(t *testing.T) {
+	tests := []struct {
+		name           string
+		x1, n1, x2, n2 int
+		want           float64
+	}{
+		{"higher second rate", 10, 100, 30, 100, 3.5355},
+		{"lower second rate", 30, 100, 10, 100, -3.5355},
+		{"equal rates", 5, 50, 10, 100, 0},
+		{"empty baseline", 0, 0, 5, 10, 0},
+		{"empty sample", 5, 10, 0, 0, 0},
+		{"both rates 0", 0, 40, 0, 40, 0},
+		{"both rates 1", 40, 40, 40, 40, 0},
+	}
+	for _, tt := range tests {
+		got := proportionZ(tt.x1, tt.n1, tt.x2, tt.n2)
+		if math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("%s: proportionZ(%d, %d, %d, %d) = %.4f, want %.4f", tt.name, tt.x1, tt.n1, tt.x2, tt.n2, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCompatMatrixFlagsOutliers(t *testing.T) {
+	cells := map[[2]string]*CompatCell{
+		{"jellyfin", "8.1"}:  {Total: 100, Success: 95, Failed: 5},
+		{"jellyfin", "8.2"}:  {Total: 20, Success: 10, Failed: 10},
+		{"jellyfin", "8.10"}: {Total: 12, Success: 12},
+		// Too few installs to be flagged, however bad.
+		{"jellyfin", "7.4"}: {Total: 3, Failed: 3},
+		// The only cell of its app: nothing to compare against.
+		{"vaultwarden", "8.2"}: {Total: 30, Success: 10, Failed: 20},
+	}
+	m := buildCompatMatrix(30, "pve", cells, 0)
+
+	if want := []string{"7.4", "8.1", "8.2", "8.10"}; !reflect.DeepEqual(m.Columns, want) {
+		t.Errorf("columns = %v, want %v", m.Columns, want)
+	}
+	if len(m.Rows) != 2 || m.Rows[0].App != "jellyfin" {
+		t.Fatalf("rows = %+v, want jellyfin first", m.Rows)
+	}
+	flagged := make(map[string]bool)
+	for _, r := range m.Rows {
+		for _, c := range r.Cells {
+			flagged[r.App+" "+c.Column] = c.Flagged
+		}
+	}
+	want := map[string]bool{
+		"jellyfin 7.4":    false,
+		"jellyfin 8.1":    false,
+		"jellyfin 8.2":    true,
+		"jellyfin 8.10":   false,
+		"vaultwarden 8.2": false,
+	}
+	if !reflect.DeepEqual(flagged, want) {
+		t.Errorf("flagged = %v, want %v", flagged, want)
+	}
+
+	// Worst combinations need compatMinSamples and at least one failure.
+	var worst []string
+	for _, w := range m.Worst {
+		worst = append(worst, w.App+" "+w.Column)
+	}
+	if want := []string{"vaultwarden 8.2", "jellyfin 8.2", "jellyfin 8.1"}; !reflect.DeepEqual(worst, want) {
+		t.Errorf("worst = %v, want %v", worst, want)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"8.9", "8.10", true},
+		{"8.10", "8.9", false},
+		{"debian 12", "debian 13", true},
+		{"alpine 3.19", "debian 12", true},
+		{"1.0", "1.0-rc1", true},
+		{"1.0", "1.0", false},
+	}
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
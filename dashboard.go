@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"strings"
 	"time"
 )
@@ -29,6 +30,7 @@ type DashboardData struct {
 	FailedApps      []AppFailure      `json:"failed_apps"`
 	RecentRecords   []TelemetryRecord `json:"recent_records"`
 	DailyStats      []DailyStat       `json:"daily_stats"`
+	Interval        string            `json:"interval"` // Bucket of daily_stats: "day" or "hour"
 
 	// Extended metrics
 	GPUStats           []GPUCount      `json:"gpu_stats"`
@@ -39,6 +41,9 @@ type DashboardData struct {
 	TotalTools         int             `json:"total_tools"`
 	TotalAddons        int             `json:"total_addons"`
 	RepoSlugs          []RepoSlugCount `json:"repo_slugs"`
+
+	// Set with compare=previous
+	Comparison *PeriodComparison `json:"comparison,omitempty"`
 }
 
 type AppCount struct {
@@ -129,6 +134,8 @@ type ErrorAnalysisData struct {
 	RecentErrors    []ErrorRecord        `json:"recent_errors"`
 	StuckInstalling int                  `json:"stuck_installing"`
 	ErrorTimeline   []ErrorTimelinePoint `json:"error_timeline"`
+	Interval        string               `json:"interval"`             // Bucket of error_timeline: "day" or "hour"
+	Comparison      *PeriodComparison    `json:"comparison,omitempty"` // Set with compare=previous
 }
 
 type ExitCodeStat struct {
@@ -188,10 +195,11 @@ type ScriptInfo struct {
 }
 
 type ScriptAnalysisData struct {
-	TotalScripts  int            `json:"total_scripts"`
-	TotalInstalls int            `json:"total_installs"`
-	TopScripts    []ScriptStat   `json:"top_scripts"`
-	RecentScripts []RecentScript `json:"recent_scripts"`
+	TotalScripts  int               `json:"total_scripts"`
+	TotalInstalls int               `json:"total_installs"`
+	TopScripts    []ScriptStat      `json:"top_scripts"`
+	RecentScripts []RecentScript    `json:"recent_scripts"`
+	Comparison    *PeriodComparison `json:"comparison,omitempty"` // Set with compare=previous
 }
 
 type ScriptStat struct {
@@ -226,7 +234,7 @@ type TelemetryRecord struct {
 }
 
 // ========================================================
-// Aggregation helpers (used by the ClickHouse dashboard build)
+// Aggregation helpers (shared by the ClickHouse and in-memory stores)
 // ========================================================
 
 // buildFailedApps ranks apps by failure rate, balancing LXC and VM entries so
@@ -341,3 +349,99 @@ func buildDailyStats(success, failed map[string]int, days int) []DailyStat {
 	}
 	return result
 }
+
+// scriptAgg is one per-app row of the script statistics aggregation.
+type scriptAgg struct {
+	App                             string
+	Type                            string
+	Total, Success, Failed, Aborted uint64
+}
+
+// buildScriptStats turns per-app aggregates into the /api/scripts payload,
+// optionally restricted to (and typed by) the known scripts metadata.
+func buildScriptStats(aggs []scriptAgg, days int, knownScripts map[string]ScriptInfo) *ScriptAnalysisData {
+	data := &ScriptAnalysisData{}
+	now := time.Now()
+	seen := make(map[string]bool)
+
+	for _, a := range aggs {
+		nsapp, typ := a.App, a.Type
+		total, sc, fc, ac := a.Total, a.Success, a.Failed, a.Aborted
+		// Filter to known scripts if provided
+		if len(knownScripts) > 0 {
+			if _, ok := knownScripts[nsapp]; !ok {
+				continue
+			}
+		}
+		seen[nsapp] = true
+
+		// Override type from script_scripts metadata
+		if knownScripts != nil {
+			if info, ok := knownScripts[nsapp]; ok {
+				typ = info.Type
+			}
+		}
+
+		completed := sc + fc + ac
+		rate := float64(0)
+		if completed > 0 {
+			rate = float64(sc) / float64(completed) * 100
+		}
+		daysOld := 0
+		installsPerDay := float64(0)
+		if knownScripts != nil {
+			if info, ok := knownScripts[nsapp]; ok && !info.Created.IsZero() {
+				daysOld = int(now.Sub(info.Created).Hours() / 24)
+				if daysOld < 1 {
+					daysOld = 1
+				}
+				installsPerDay = float64(total) / float64(daysOld)
+			}
+		}
+
+		data.TopScripts = append(data.TopScripts, ScriptStat{
+			App: nsapp, Type: typ,
+			Total: int(total), Success: int(sc), Failed: int(fc), Aborted: int(ac),
+			SuccessRate: rate, DaysOld: daysOld, InstallsPerDay: installsPerDay,
+		})
+		data.TotalInstalls += int(total)
+	}
+
+	// Add zero-usage known scripts (30d + alltime)
+	if knownScripts != nil && (days == 0 || days >= 30) {
+		for slug, info := range knownScripts {
+			if !seen[slug] {
+				daysOld := 0
+				if !info.Created.IsZero() {
+					daysOld = int(now.Sub(info.Created).Hours() / 24)
+					if daysOld < 1 {
+						daysOld = 1
+					}
+				}
+				data.TopScripts = append(data.TopScripts, ScriptStat{
+					App: slug, Type: info.Type, DaysOld: daysOld,
+				})
+			}
+		}
+	}
+	data.TotalScripts = len(data.TopScripts)
+
+	return data
+}
+
+// proportionZ returns the two-proportion z-score of x2/n2 against the baseline
+// x1/n1 (pooled standard error). Positive means the second rate is higher; 0 is
+// returned when either sample is empty or both rates are 0 or 1.
+func proportionZ(x1, n1, x2, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 0
+	}
+	p1 := float64(x1) / float64(n1)
+	p2 := float64(x2) / float64(n2)
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 0
+	}
+	return (p2 - p1) / se
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ---------- Dead letters ----------
+// Payloads that cannot be decoded, fail validation, or are given up on after
+// all write retries are persisted to telemetry_db.dead_letters (30 day TTL)
+// together with the rejection reason, instead of only showing up in the log.
+// Admins can list them, group them by reason and replay selected entries after
+// a rule or allowlist change.
+
+const (
+	deadLetterStageDecode   = "decode"
+	deadLetterStageValidate = "validate"
+	deadLetterStageWrite    = "write"
+
+	deadLetterMaxReason = 512
+)
+
+// DeadLetter is one rejected or undeliverable payload.
+type DeadLetter struct {
+	ID          string `json:"id"`
+	Created     string `json:"created"`
+	Stage       string `json:"stage"` // "decode", "validate" or "write"
+	Reason      string `json:"reason"`
+	NSAPP       string `json:"nsapp,omitempty"`
+	ExecutionID string `json:"execution_id,omitempty"`
+	Body        string `json:"body"`
+}
+
+// DeadLetterReason is one row of the grouped dead-letter summary.
+type DeadLetterReason struct {
+	Stage    string `json:"stage"`
+	Reason   string `json:"reason"`
+	Count    uint64 `json:"count"`
+	LastSeen string `json:"last_seen"`
+}
+
+// DeadLetterStore buffers dead letters and writes them to ClickHouse in the
+// background so the ingest path never blocks on it.
+type DeadLetterStore struct {
+	ch        Store
+	queue     chan DeadLetter
+	done      chan struct{} // closed when the writer has flushed and returned
+	maxBody   int           // bytes of (sanitized) body kept per entry
+	reasonCap int           // entries kept per stage and reason per UTC day (0 = no cap)
+
+	mu     sync.Mutex
+	closed bool           // set by Stop; later entries are dropped
+	day    string         // UTC day the counts belong to
+	counts map[string]int // entries accepted today per stage and reason
+}
+
+// NewDeadLetterStore creates a store with a bounded in-memory buffer. Bodies
+// are kept up to maxBody bytes, the ingest body limit. At most reasonCap
+// entries are kept per stage and reason per day, so a client repeating the
+// same bad payload cannot fill the table.
+func NewDeadLetterStore(ch Store, capacity int, maxBody int64, reasonCap int) *DeadLetterStore {
+	return &DeadLetterStore{
+		ch:        ch,
+		queue:     make(chan DeadLetter, capacity),
+		done:      make(chan struct{}),
+		maxBody:   int(maxBody),
+		reasonCap: reasonCap,
+		counts:    make(map[string]int),
+	}
+}
+
+// Start launches the background writer.
+func (d *DeadLetterStore) Start() {
+	go d.loop()
+}
+
+// Stop closes the buffer and waits until the writer has flushed what is left
+// or the timeout elapses. Call it after WriteQueue.Stop, which may still
+// record write failures while draining.
+func (d *DeadLetterStore) Stop(timeout time.Duration) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		log.Printf("[DLQ] flushed")
+	case <-time.After(timeout):
+		log.Printf("[DLQ] flush timed out after %v, remaining dead letters lost", timeout)
+	}
+}
+
+// Record queues a dead letter. The body is IP-anonymized before it is stored.
+// Safe to call on a nil store.
+func (d *DeadLetterStore) Record(stage, reason string, body []byte, nsapp, executionID string) {
+	if d == nil {
+		return
+	}
+	reason = truncateUTF8(reason, deadLetterMaxReason)
+	if !d.admit(stage, reason) {
+		metricDeadLettersDropped.Inc("cap")
+		return
+	}
+	b := sanitizeIPs(string(body))
+	if len(b) > d.maxBody {
+		b = shrinkDeadLetterBody(b, d.maxBody)
+	}
+	dl := DeadLetter{
+		ID:          generateRecordID(),
+		Stage:       stage,
+		Reason:      reason,
+		NSAPP:       sanitizeShort(nsapp, 64),
+		ExecutionID: sanitizeShort(executionID, 64),
+		Body:        b,
+	}
+	// The lock keeps Stop from closing the queue during the send.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		metricDeadLettersDropped.Inc("stopped")
+		log.Printf("[DLQ] stopped, dropping dead letter stage=%s nsapp=%s", stage, dl.NSAPP)
+		return
+	}
+	select {
+	case d.queue <- dl:
+	default:
+		metricDeadLettersDropped.Inc("buffer")
+		log.Printf("[DLQ] buffer full, dropping dead letter stage=%s nsapp=%s", stage, dl.NSAPP)
+	}
+}
+
+// admit counts an entry against the daily cap of its stage and reason and
+// reports whether it may be kept. The counts start over every UTC day; the
+// first entry over the cap is logged.
+func (d *DeadLetterStore) admit(stage, reason string) bool {
+	if d.reasonCap <= 0 {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if today := time.Now().UTC().Format("2006-01-02"); today != d.day {
+		d.day = today
+		clear(d.counts)
+	}
+	key := stage + "|" + reason
+	d.counts[key]++
+	if n := d.counts[key]; n > d.reasonCap {
+		if n == d.reasonCap+1 {
+			log.Printf("[DLQ] daily cap of %d reached for stage=%s reason=%q, dropping further entries today", d.reasonCap, stage, reason)
+		}
+		return false
+	}
+	return true
+}
+
+// shrinkDeadLetterBody fits a JSON body into max bytes by shortening its
+// "error" field, so the stored body stays valid JSON and can be replayed.
+// Ingested bodies never exceed the limit; re-encoded write failures can, as
+// JSON escaping grows the error text. Bodies without an error string to cut
+// are kept whole.
+func shrinkDeadLetterBody(body string, max int) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return body
+	}
+	var errText string
+	if err := json.Unmarshal(fields["error"], &errText); err != nil {
+		return body
+	}
+	for {
+		raw, err := marshalNoEscape(errText)
+		if err != nil {
+			return body
+		}
+		fields["error"] = raw
+		out, err := marshalNoEscape(fields)
+		if err != nil {
+			return body
+		}
+		body = string(out)
+		if len(body) <= max || errText == "" {
+			return body
+		}
+		// Scale the text to the space left for its encoding; escapes make
+		// the encoding longer than the text, so a second pass may be needed.
+		keep := 0
+		if budget := max - (len(body) - len(raw)); budget > 0 {
+			keep = min(len(errText)-1, len(errText)*budget/len(raw))
+		}
+		errText = truncateUTF8(errText, keep)
+	}
+}
+
+// marshalNoEscape encodes v like json.Marshal but keeps <, > and & as is.
+func marshalNoEscape(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a rune.
+func truncateUTF8(s string, max int) string {
+	if max <= 0 {
+		return ""
+	}
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// loop flushes buffered dead letters every 2s or every 100 entries, and once
+// more when Stop closes the queue.
+func (d *DeadLetterStore) loop() {
+	defer close(d.done)
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	var batch []DeadLetter
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := d.ch.InsertDeadLetters(ctx, batch); err != nil {
+			log.Printf("[DLQ] failed to write %d dead letters: %v", len(batch), err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case dl, ok := <-d.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, dl)
+			if len(batch) >= 100 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// ---------- Replay ----------
+
+// DeadLetterReplayResult is the per-entry outcome of a replay.
+type DeadLetterReplayResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"` // "replayed" or "rejected"
+	Error  string `json:"error,omitempty"`
+}
+
+// Replay pushes a dead letter through the pipeline again. Decode and validate
+// rejects are re-ingested from the stored body (so current rules apply);
+// write failures were already normalized and go straight to the write queue.
+// A replay that fails again is not recorded as a new dead letter.
+func (ing *Ingestor) Replay(dl DeadLetter) error {
+	if dl.Stage == deadLetterStageWrite {
+		var out TelemetryOut
+		if err := json.Unmarshal([]byte(dl.Body), &out); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidJSON, err)
+		}
+		if !ing.queue.Enqueue(out) {
+			return errServerBusy
+		}
+		return nil
+	}
+	_, err := ing.process([]byte(dl.Body))
+	return err
+}
+
+// ══════════════════════════════════════════════════════════════
+//  DEAD LETTER QUERIES
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) InsertDeadLetters(ctx context.Context, rows []DeadLetter) error {
+	tx, err := ch.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO telemetry_db.dead_letters (id, created, stage, reason, nsapp, execution_id, body)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, dl := range rows {
+		if _, err := stmt.ExecContext(ctx, dl.ID, now, dl.Stage, dl.Reason, dl.NSAPP, dl.ExecutionID, dl.Body); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// deadLetterWhere builds the WHERE clause shared by the dead-letter listings.
+func deadLetterWhere(stage, reason string) (string, []interface{}) {
+	parts := []string{"1=1"}
+	var args []interface{}
+	if stage != "" {
+		parts = append(parts, "stage = ?")
+		args = append(args, stage)
+	}
+	if reason != "" {
+		parts = append(parts, "reason = ?")
+		args = append(args, reason)
+	}
+	return strings.Join(parts, " AND "), args
+}
+
+func scanDeadLetters(rows *sql.Rows) ([]DeadLetter, error) {
+	var out []DeadLetter
+	for rows.Next() {
+		var dl DeadLetter
+		var created time.Time
+		if err := rows.Scan(&dl.ID, &created, &dl.Stage, &dl.Reason, &dl.NSAPP, &dl.ExecutionID, &dl.Body); err != nil {
+			return nil, err
+		}
+		dl.Created = created.UTC().Format(time.RFC3339)
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// FetchDeadLetters returns one page of dead letters (newest first) and the total count.
+func (ch *CHClient) FetchDeadLetters(ctx context.Context, stage, reason string, page, limit int) ([]DeadLetter, uint64, error) {
+	where, args := deadLetterWhere(stage, reason)
+
+	var total uint64
+	if err := ch.db.QueryRowContext(ctx,
+		"SELECT count() FROM telemetry_db.dead_letters WHERE "+where, args...,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, created, stage, reason, nsapp, execution_id, body
+		FROM telemetry_db.dead_letters
+		WHERE %s
+		ORDER BY created DESC
+		LIMIT %d OFFSET %d`, where, limit, (page-1)*limit), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	list, err := scanDeadLetters(rows)
+	return list, total, err
+}
+
+// FetchDeadLettersByID loads specific dead letters (for replay).
+func (ch *CHClient) FetchDeadLettersByID(ctx context.Context, ids []string) ([]DeadLetter, error) {
+	rows, err := ch.db.QueryContext(ctx, `
+		SELECT id, created, stage, reason, nsapp, execution_id, body
+		FROM telemetry_db.dead_letters
+		WHERE has(?, id)
+		ORDER BY created`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanDeadLetters(rows)
+}
+
+// FetchDeadLetterSummary groups dead letters of the last `days` days by stage and reason.
+func (ch *CHClient) FetchDeadLetterSummary(ctx context.Context, days int) ([]DeadLetterReason, error) {
+	rows, err := ch.db.QueryContext(ctx, `
+		SELECT stage, reason, count() AS cnt, max(created) AS last_seen
+		FROM telemetry_db.dead_letters
+		WHERE created >= ?
+		GROUP BY stage, reason
+		ORDER BY cnt DESC
+		LIMIT 200`, chSinceTime(days))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DeadLetterReason
+	for rows.Next() {
+		var r DeadLetterReason
+		var last time.Time
+		if err := rows.Scan(&r.Stage, &r.Reason, &r.Count, &last); err != nil {
+			return nil, err
+		}
+		r.LastSeen = last.UTC().Format(time.RFC3339)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// DeleteDeadLetters removes replayed entries.
+func (ch *CHClient) DeleteDeadLetters(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := ch.db.ExecContext(ctx,
+		"ALTER TABLE telemetry_db.dead_letters DELETE WHERE has(?, id)", ids)
+	return err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadLetterStopFlushesBuffer(t *testing.T) {
+	store := NewMemStore()
+	d := NewDeadLetterStore(store, 100, 1024, 0)
+	d.Start()
+	for i := 0; i < 3; i++ {
+		d.Record(deadLetterStageDecode, "bad json", []byte(`{`), "", "")
+	}
+	d.Stop(5 * time.Second)
+
+	store.mu.RLock()
+	n := len(store.dead)
+	store.mu.RUnlock()
+	if n != 3 {
+		t.Fatalf("stored %d dead letters after Stop, want 3", n)
+	}
+
+	// Records after Stop are dropped instead of panicking on the closed queue.
+	d.Record(deadLetterStageDecode, "bad json", []byte(`{`), "", "")
+	d.Stop(time.Second)
+}
+
+func TestDeadLetterReasonCap(t *testing.T) {
+	d := NewDeadLetterStore(NewMemStore(), 100, 1024, 2)
+	for i := 0; i < 5; i++ {
+		d.Record(deadLetterStageValidate, "type: must be one of lxc, vm", []byte(`{}`), "", "")
+	}
+	d.Record(deadLetterStageValidate, "status: required", []byte(`{}`), "", "")
+	d.Record(deadLetterStageDecode, "type: must be one of lxc, vm", []byte(`{}`), "", "")
+	if n := len(d.queue); n != 4 {
+		t.Fatalf("queued %d dead letters, want 2 of the capped reason and one of each other", n)
+	}
+
+	// The counts start over on a new day.
+	d.mu.Lock()
+	d.day = "2000-01-01"
+	d.mu.Unlock()
+	d.Record(deadLetterStageValidate, "type: must be one of lxc, vm", []byte(`{}`), "", "")
+	if n := len(d.queue); n != 5 {
+		t.Fatalf("queued %d dead letters after the day changed, want 5", n)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ---------- Install duration percentiles ----------
+// Averages are skewed by long builds and stalled installs, so runtime is
+// reported as p50/p90/p99 of successful installs. ClickHouse keeps quantile
+// states per (day, nsapp, type, os_type, repo_source) in mv_daily_duration and
+// merges them for the requested window.
+
+// durationMinSamples is the minimum number of successful installs a group needs
+// before its percentiles are reported.
+const durationMinSamples = 10
+
+// durationGroupCols maps the ?by= values to their column.
+var durationGroupCols = map[string]string{
+	"app":  "nsapp",
+	"type": "type",
+	"os":   "os_type",
+}
+
+// DurationStat holds the install duration percentiles (seconds) of one group.
+type DurationStat struct {
+	Key   string  `json:"key"`
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+}
+
+// DurationData is the response of /api/durations.
+type DurationData struct {
+	Days  int            `json:"days"`
+	By    string         `json:"by"`
+	Stats []DurationStat `json:"stats"`
+}
+
+// percentile returns the q-quantile (0..1) of sorted values using linear
+// interpolation between the closest ranks.
+func percentile(sorted []int, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	frac := pos - float64(lo)
+	return float64(sorted[lo]) + (float64(sorted[hi])-float64(sorted[lo]))*frac
+}
+
+// ══════════════════════════════════════════════════════════════
+//  DURATION PERCENTILES (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchDurationStats(ctx context.Context, days int, repoSource, repoSlug, by, app, typeFilter, osType string) (*DurationData, error) {
+	col, ok := durationGroupCols[by]
+	if !ok {
+		return nil, fmt.Errorf("invalid group %q", by)
+	}
+
+	var extras []string
+	var extraArgs []interface{}
+	for _, f := range []struct{ col, val string }{{"nsapp", app}, {"type", typeFilter}, {"os_type", osType}} {
+		if f.val != "" {
+			extras = append(extras, f.col+" = ?")
+			extraArgs = append(extraArgs, f.val)
+		}
+	}
+
+	var query string
+	var args []interface{}
+	if repoSlug != "" {
+		w, a := chWhere(days, repoSource, repoSlug, append([]string{"status = 'success'", "install_duration > 0"}, extras...)...)
+		query = fmt.Sprintf(`
+			SELECT %s k, count() c, quantiles(0.5, 0.9, 0.99)(install_duration)
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY k HAVING c >= %d
+			ORDER BY c DESC LIMIT 200`, col, w, durationMinSamples)
+		args = append(a, extraArgs...)
+	} else {
+		w, a := chMVWhere(days, repoSource)
+		if len(extras) > 0 {
+			w += " AND " + strings.Join(extras, " AND ")
+		}
+		query = fmt.Sprintf(`
+			SELECT %s k, sum(cnt) c, quantilesMerge(0.5, 0.9, 0.99)(dur)
+			FROM telemetry_db.mv_daily_duration WHERE %s
+			GROUP BY k HAVING c >= %d
+			ORDER BY c DESC LIMIT 200`, col, w, durationMinSamples)
+		args = append(a, extraArgs...)
+	}
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH duration stats: %w", err)
+	}
+	defer rows.Close()
+
+	data := &DurationData{Days: days, By: by}
+	for rows.Next() {
+		var s DurationStat
+		var c uint64
+		var q []float64
+		if err := rows.Scan(&s.Key, &c, &q); err != nil || len(q) != 3 {
+			continue
+		}
+		s.Count = int(c)
+		s.P50, s.P90, s.P99 = q[0], q[1], q[2]
+		data.Stats = append(data.Stats, s)
+	}
+	return data, rows.Err()
+}
+
+// ══════════════════════════════════════════════════════════════
+//  DURATION PERCENTILES (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchDurationStats(ctx context.Context, days int, repoSource, repoSlug, by, app, typeFilter, osType string) (*DurationData, error) {
+	if _, ok := durationGroupCols[by]; !ok {
+		return nil, fmt.Errorf("invalid group %q", by)
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := make(map[string][]int)
+	for _, r := range m.rows {
+		if r.Status != "success" || r.InstallDuration <= 0 || !memMatch(r, days, repoSource, repoSlug) ||
+			(app != "" && r.NSAPP != app) || (typeFilter != "" && r.Type != typeFilter) || (osType != "" && r.OsType != osType) {
+			continue
+		}
+		key := r.NSAPP
+		switch by {
+		case "type":
+			key = r.Type
+		case "os":
+			key = r.OsType
+		}
+		groups[key] = append(groups[key], r.InstallDuration)
+	}
+
+	data := &DurationData{Days: days, By: by}
+	for key, vals := range groups {
+		if len(vals) < durationMinSamples {
+			continue
+		}
+		sort.Ints(vals)
+		data.Stats = append(data.Stats, DurationStat{
+			Key:   key,
+			Count: len(vals),
+			P50:   percentile(vals, 0.5),
+			P90:   percentile(vals, 0.9),
+			P99:   percentile(vals, 0.99),
+		})
+	}
+	sort.Slice(data.Stats, func(i, j int) bool {
+		if data.Stats[i].Count != data.Stats[j].Count {
+			return data.Stats[i].Count > data.Stats[j].Count
+		}
+		return data.Stats[i].Key < data.Stats[j].Key
+	})
+	if len(data.Stats) > 200 {
+		data.Stats = data.Stats[:200]
+	}
+	return data, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	ten := []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	tests := []struct {
+		vals []int
+		q    float64
+		want float64
+	}{
+		{nil, 0.5, 0},
+		{[]int{42}, 0.99, 42},
+		{ten, 0, 10},
+		{ten, 0.5, 55},
+		{ten, 0.9, 91},
+		{ten, 0.99, 99.1},
+		{ten, 1, 100},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.vals, tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.vals, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestMemStoreDurationStats(t *testing.T) {
+	m := NewMemStore()
+	now := time.Now().UTC()
+	add := func(app, status string, seconds int) {
+		m.rows = append(m.rows, memRow{
+			TelemetryOut: TelemetryOut{NSAPP: app, Type: "lxc", Status: status, InstallDuration: seconds, RepoSource: "ProxmoxVE"},
+			Created:      now,
+		})
+	}
+	for i := 1; i <= 10; i++ {
+		add("jellyfin", "success", i*10)
+	}
+	// Failed installs, missing durations and groups below durationMinSamples
+	// are left out.
+	add("jellyfin", "failed", 5000)
+	add("jellyfin", "success", 0)
+	for i := 0; i < durationMinSamples-1; i++ {
+		add("pihole", "success", 60)
+	}
+
+	data, err := m.FetchDurationStats(context.Background(), 7, "ProxmoxVE", "", "app", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Stats) != 1 {
+		t.Fatalf("stats = %+v, want only jellyfin", data.Stats)
+	}
+	if s := data.Stats[0]; s.Key != "jellyfin" || s.Count != 10 || s.P50 != 55 || math.Abs(s.P99-99.1) > 1e-9 {
+		t.Errorf("jellyfin = %+v, want 10 installs, p50 55, p99 99.1", s)
+	}
+
+	if _, err := m.FetchDurationStats(context.Background(), 7, "", "", "bogus", "", "", ""); err == nil {
+		t.Error("unknown group was accepted")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------- Execution index backends ----------
+// The write workers deduplicate "installing" and terminal events per
+// execution_id. The in-memory ExecIndex only sees the events of its own
+// process; with several ingest replicas behind the load balancer the index must
+// be shared, otherwise each replica writes its own copy of a repeated failure.
+// EXEC_INDEX_BACKEND=redis keeps the marks in Redis (same REDIS_URL as the
+// cache) with SET NX semantics and a TTL. The write workers use the *Many
+// variants, which cost one Redis round-trip per batch instead of one per row.
+
+// ExecutionIndex tracks in-flight and finished executions for deduplication.
+type ExecutionIndex interface {
+	Get(executionID string) (string, bool)
+	Set(executionID, recordID string)
+	Delete(executionID string)
+	// MarkTerminalIfAbsent atomically records a terminal event and reports
+	// whether the caller is the first to do so.
+	MarkTerminalIfAbsent(executionID string) bool
+	UnmarkTerminal(executionID string)
+
+	// GetMany reports which of the executions have an installing mark.
+	GetMany(executionIDs []string) map[string]bool
+	// SetMany records installing marks (execution_id -> record_id).
+	SetMany(records map[string]string)
+	DeleteMany(executionIDs []string)
+	// MarkTerminalIfAbsentMany is MarkTerminalIfAbsent for each id in order;
+	// of repeated ids only the first can be reported as first.
+	MarkTerminalIfAbsentMany(executionIDs []string) []bool
+	UnmarkTerminalMany(executionIDs []string)
+}
+
+var (
+	_ ExecutionIndex = (*ExecIndex)(nil)
+	_ ExecutionIndex = (*RedisExecIndex)(nil)
+)
+
+const (
+	execIndexKeyInstalling = "exec:installing:"
+	execIndexKeyTerminal   = "exec:terminal:"
+)
+
+// RedisExecIndex stores the execution marks in Redis. If Redis is unreachable
+// the local index is used instead, so a Redis outage degrades to per-replica
+// dedup (plus the ClickHouse check) rather than blocking writes.
+type RedisExecIndex struct {
+	client  *redis.Client
+	ttl     time.Duration
+	timeout time.Duration
+	local   *ExecIndex
+}
+
+// NewRedisExecIndex creates a Redis-backed index. Marks expire after ttl
+// (duplicates arrive within seconds; older ones are caught by ClickHouse).
+func NewRedisExecIndex(client *redis.Client, ttl time.Duration, local *ExecIndex) *RedisExecIndex {
+	return &RedisExecIndex{
+		client:  client,
+		ttl:     ttl,
+		timeout: 500 * time.Millisecond,
+		local:   local,
+	}
+}
+
+// DialRedisExecIndex connects to redisURL and verifies the connection.
+func DialRedisExecIndex(redisURL string, ttl time.Duration, local *ExecIndex) (*RedisExecIndex, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return NewRedisExecIndex(client, ttl, local), nil
+}
+
+func (idx *RedisExecIndex) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), idx.timeout)
+}
+
+func (idx *RedisExecIndex) Get(executionID string) (string, bool) {
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	v, err := idx.client.Get(ctx, execIndexKeyInstalling+executionID).Result()
+	switch {
+	case err == redis.Nil:
+		return "", false
+	case err != nil:
+		log.Printf("[INDEX] redis get failed, using local index: %v", err)
+		return idx.local.Get(executionID)
+	}
+	return v, true
+}
+
+func (idx *RedisExecIndex) Set(executionID, recordID string) {
+	if executionID == "" || recordID == "" {
+		return
+	}
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	if err := idx.client.Set(ctx, execIndexKeyInstalling+executionID, recordID, idx.ttl).Err(); err != nil {
+		log.Printf("[INDEX] redis set failed, using local index: %v", err)
+		idx.local.Set(executionID, recordID)
+	}
+}
+
+func (idx *RedisExecIndex) Delete(executionID string) {
+	idx.local.Delete(executionID)
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	if err := idx.client.Del(ctx, execIndexKeyInstalling+executionID).Err(); err != nil {
+		log.Printf("[INDEX] redis del failed: %v", err)
+	}
+}
+
+func (idx *RedisExecIndex) MarkTerminalIfAbsent(executionID string) bool {
+	if executionID == "" {
+		return true
+	}
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	ok, err := idx.client.SetNX(ctx, execIndexKeyTerminal+executionID, time.Now().Unix(), idx.ttl).Result()
+	if err != nil {
+		log.Printf("[INDEX] redis setnx failed, using local index: %v", err)
+		return idx.local.MarkTerminalIfAbsent(executionID)
+	}
+	return ok
+}
+
+func (idx *RedisExecIndex) UnmarkTerminal(executionID string) {
+	if executionID == "" {
+		return
+	}
+	idx.local.UnmarkTerminal(executionID)
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	if err := idx.client.Del(ctx, execIndexKeyTerminal+executionID).Err(); err != nil {
+		log.Printf("[INDEX] redis del failed: %v", err)
+	}
+}
+
+func (idx *RedisExecIndex) GetMany(executionIDs []string) map[string]bool {
+	found := make(map[string]bool)
+	if len(executionIDs) == 0 {
+		return found
+	}
+	keys := make([]string, len(executionIDs))
+	for i, id := range executionIDs {
+		keys[i] = execIndexKeyInstalling + id
+	}
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	vals, err := idx.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("[INDEX] redis mget failed, using local index: %v", err)
+		return idx.local.GetMany(executionIDs)
+	}
+	for i, v := range vals {
+		if v != nil {
+			found[executionIDs[i]] = true
+		}
+	}
+	return found
+}
+
+func (idx *RedisExecIndex) SetMany(records map[string]string) {
+	if len(records) == 0 {
+		return
+	}
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	pipe := idx.client.Pipeline()
+	for executionID, recordID := range records {
+		if executionID != "" && recordID != "" {
+			pipe.Set(ctx, execIndexKeyInstalling+executionID, recordID, idx.ttl)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[INDEX] redis set failed, using local index: %v", err)
+		idx.local.SetMany(records)
+	}
+}
+
+func (idx *RedisExecIndex) DeleteMany(executionIDs []string) {
+	idx.local.DeleteMany(executionIDs)
+	idx.del(execIndexKeyInstalling, executionIDs)
+}
+
+func (idx *RedisExecIndex) MarkTerminalIfAbsentMany(executionIDs []string) []bool {
+	first := make([]bool, len(executionIDs))
+	if len(executionIDs) == 0 {
+		return first
+	}
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	pipe := idx.client.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(executionIDs))
+	now := time.Now().Unix()
+	for i, id := range executionIDs {
+		if id != "" {
+			cmds[i] = pipe.SetNX(ctx, execIndexKeyTerminal+id, now, idx.ttl)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("[INDEX] redis setnx failed, using local index: %v", err)
+		return idx.local.MarkTerminalIfAbsentMany(executionIDs)
+	}
+	for i, cmd := range cmds {
+		first[i] = cmd == nil || cmd.Val()
+	}
+	return first
+}
+
+func (idx *RedisExecIndex) UnmarkTerminalMany(executionIDs []string) {
+	idx.local.UnmarkTerminalMany(executionIDs)
+	idx.del(execIndexKeyTerminal, executionIDs)
+}
+
+// del removes the keys of the given executions with one DEL.
+func (idx *RedisExecIndex) del(prefix string, executionIDs []string) {
+	keys := make([]string, 0, len(executionIDs))
+	for _, id := range executionIDs {
+		if id != "" {
+			keys = append(keys, prefix+id)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	ctx, cancel := idx.ctx()
+	defer cancel()
+	if err := idx.client.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("[INDEX] redis del failed: %v", err)
+	}
+}
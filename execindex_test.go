@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisIndex(t *testing.T) (*RedisExecIndex, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisExecIndex(client, time.Hour, NewExecIndex()), mr
+}
+
+func TestRedisExecIndexGetSetDelete(t *testing.T) {
+	idx, mr := newTestRedisIndex(t)
+
+	if _, ok := idx.Get("exec-1"); ok {
+		t.Fatal("Get on empty index found a mark")
+	}
+	idx.Set("exec-1", "rec-1")
+	if v, ok := idx.Get("exec-1"); !ok || v != "rec-1" {
+		t.Fatalf("Get = %q, %v; want rec-1, true", v, ok)
+	}
+	if ttl := mr.TTL(execIndexKeyInstalling + "exec-1"); ttl != time.Hour {
+		t.Errorf("TTL = %v, want 1h", ttl)
+	}
+
+	idx.Set("", "rec-2")
+	idx.Set("exec-2", "")
+	if n := len(mr.Keys()); n != 1 {
+		t.Errorf("empty ids were stored: %d keys", n)
+	}
+
+	idx.Delete("exec-1")
+	if _, ok := idx.Get("exec-1"); ok {
+		t.Error("Get found a deleted mark")
+	}
+
+	idx.Set("exec-3", "rec-3")
+	mr.FastForward(2 * time.Hour)
+	if _, ok := idx.Get("exec-3"); ok {
+		t.Error("mark did not expire")
+	}
+}
+
+func TestRedisExecIndexTerminal(t *testing.T) {
+	idx, _ := newTestRedisIndex(t)
+
+	if !idx.MarkTerminalIfAbsent("exec-1") {
+		t.Fatal("first mark was not reported as first")
+	}
+	if idx.MarkTerminalIfAbsent("exec-1") {
+		t.Fatal("second mark was reported as first")
+	}
+	idx.UnmarkTerminal("exec-1")
+	if !idx.MarkTerminalIfAbsent("exec-1") {
+		t.Fatal("mark after UnmarkTerminal was not reported as first")
+	}
+	if !idx.MarkTerminalIfAbsent("") || !idx.MarkTerminalIfAbsent("") {
+		t.Error("empty execution ids must always be written")
+	}
+}
+
+func TestRedisExecIndexMany(t *testing.T) {
+	idx, _ := newTestRedisIndex(t)
+
+	idx.SetMany(map[string]string{"a": "a", "b": "b"})
+	found := idx.GetMany([]string{"a", "b", "c"})
+	if !found["a"] || !found["b"] || found["c"] {
+		t.Fatalf("GetMany = %v, want a and b", found)
+	}
+	idx.DeleteMany([]string{"a", "c"})
+	if found := idx.GetMany([]string{"a", "b"}); found["a"] || !found["b"] {
+		t.Fatalf("GetMany after DeleteMany = %v, want b", found)
+	}
+
+	idx.MarkTerminalIfAbsent("x")
+	got := idx.MarkTerminalIfAbsentMany([]string{"x", "y", "y", "", "z"})
+	want := []bool{false, true, false, true, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("MarkTerminalIfAbsentMany = %v, want %v", got, want)
+		}
+	}
+	idx.UnmarkTerminalMany([]string{"y", "z"})
+	got = idx.MarkTerminalIfAbsentMany([]string{"x", "y", "z"})
+	if got[0] || !got[1] || !got[2] {
+		t.Fatalf("MarkTerminalIfAbsentMany after UnmarkTerminalMany = %v, want [false true true]", got)
+	}
+}
+
+func TestRedisExecIndexFallsBackToLocal(t *testing.T) {
+	idx, mr := newTestRedisIndex(t)
+	mr.Close()
+
+	idx.Set("exec-1", "rec-1")
+	if v, ok := idx.Get("exec-1"); !ok || v != "rec-1" {
+		t.Fatalf("Get without Redis = %q, %v; want the local mark", v, ok)
+	}
+	if !idx.MarkTerminalIfAbsent("exec-1") || idx.MarkTerminalIfAbsent("exec-1") {
+		t.Fatal("terminal marks without Redis are not deduplicated locally")
+	}
+	if got := idx.MarkTerminalIfAbsentMany([]string{"exec-1", "exec-2"}); got[0] || !got[1] {
+		t.Fatalf("MarkTerminalIfAbsentMany without Redis = %v, want [false true]", got)
+	}
+	idx.SetMany(map[string]string{"exec-3": "rec-3"})
+	if found := idx.GetMany([]string{"exec-1", "exec-3"}); !found["exec-1"] || !found["exec-3"] {
+		t.Fatalf("GetMany without Redis = %v, want both local marks", found)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Error fingerprinting ----------
+// The error column holds up to 128 KB of install log, so grouping failures by
+// exit code alone lumps unrelated problems together. At ingest the tail of the
+// log is normalized (numbers, paths, hashes, versions, timestamps and the
+// anonymized IP fragments are replaced by placeholders) and hashed into
+// error_fingerprint. Failures with the same fingerprint are the same problem
+// seen on different hosts, apps or runs.
+
+const (
+	// fingerprintLines is the number of trailing non-empty log lines that make
+	// up the fingerprint; the actual error is almost always at the end.
+	fingerprintLines = 5
+	// errorSampleBytes is how much of the log tail is kept as the
+	// representative excerpt of a cluster.
+	errorSampleBytes = 2048
+)
+
+// Normalization rules, applied in order (more specific patterns first).
+var fingerprintRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`), ""},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[t ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b`), "<ts>"},
+	{regexp.MustCompile(`\b\d{1,3}\.x\.x(?:\.\d{1,3})?\b`), "<ip>"},
+	{regexp.MustCompile(`\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b[0-9a-f]{7,64}\b`), "<hash>"},
+	{regexp.MustCompile(`(?:https?|ftp)://\S+`), "<url>"},
+	{regexp.MustCompile(`(^|[\s'"=:(\[])(?:~|\.{1,2})?(?:/[\w.+@%-]+)+/?`), "${1}<path>"},
+	{regexp.MustCompile(`\bv?\d+(?:\.\d+)+(?:[-+~][\w.]+)?\b`), "<ver>"},
+	{regexp.MustCompile(`\d+`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// normalizeErrorText reduces an error log to the variable-free form used for
+// fingerprinting: the last fingerprintLines non-empty lines, lowercased, with
+// all run-specific tokens replaced by placeholders.
+func normalizeErrorText(s string) string {
+	lines := strings.Split(strings.ToLower(s), "\n")
+	var out []string
+	for i := len(lines) - 1; i >= 0 && len(out) < fingerprintLines; i-- {
+		l := lines[i]
+		for _, r := range fingerprintRules {
+			l = r.re.ReplaceAllString(l, r.repl)
+		}
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	// restore log order
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return strings.Join(out, "\n")
+}
+
+// errorFingerprint returns a short stable hash of the normalized error text,
+// or "" when there is nothing to fingerprint.
+func errorFingerprint(s string) string {
+	n := normalizeErrorText(s)
+	if n == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(n))
+	return hex.EncodeToString(sum[:8])
+}
+
+// errorExcerpt returns the tail of an error log for display (last
+// fingerprintLines non-empty lines).
+func errorExcerpt(s string) string {
+	if len(s) > errorSampleBytes {
+		s = s[len(s)-errorSampleBytes:]
+	}
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	var out []string
+	for i := len(lines) - 1; i >= 0 && len(out) < fingerprintLines; i-- {
+		if l := strings.TrimRight(lines[i], " \r\t"); strings.TrimSpace(l) != "" {
+			out = append([]string{l}, out...)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// ErrorCluster is a group of failures sharing the same fingerprint.
+type ErrorCluster struct {
+	Fingerprint string   `json:"fingerprint"`
+	Count       int      `json:"count"`
+	Percentage  float64  `json:"percentage"`
+	AppCount    int      `json:"app_count"`
+	TopApps     []string `json:"top_apps"`
+	ExitCode    int      `json:"exit_code"`
+	Category    string   `json:"category"`
+	FirstSeen   string   `json:"first_seen"`
+	LastSeen    string   `json:"last_seen"`
+	Excerpt     string   `json:"excerpt"`
+}
+
+// ErrorClusterData is the response of /api/errors/clusters.
+type ErrorClusterData struct {
+	Days        int            `json:"days"`
+	TotalErrors int            `json:"total_errors"`
+	Clusters    []ErrorCluster `json:"clusters"`
+}
+
+// finish computes the cluster shares and trims the excerpts.
+func (d *ErrorClusterData) finish() {
+	if d.Clusters == nil {
+		d.Clusters = []ErrorCluster{}
+	}
+	for i := range d.Clusters {
+		c := &d.Clusters[i]
+		if d.TotalErrors > 0 {
+			c.Percentage = float64(c.Count) / float64(d.TotalErrors) * 100
+		}
+		c.Excerpt = errorExcerpt(c.Excerpt)
+	}
+}
+
+// ══════════════════════════════════════════════════════════════
+//  ERROR CLUSTERS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchErrorClusters(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*ErrorClusterData, error) {
+	var query string
+	var args []interface{}
+	if repoSlug != "" {
+		extras := []string{"status = 'failed'", "error_category != 'user_aborted'", "exit_code != 0", "error_fingerprint != ''"}
+		if app != "" {
+			extras = append(extras, "nsapp = ?")
+		}
+		w, a := chWhere(days, repoSource, repoSlug, extras...)
+		if app != "" {
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT error_fingerprint, count() c, uniqExact(nsapp),
+				topK(5)(nsapp), topK(1)(exit_code), topK(1)(error_category),
+				min(created), max(created),
+				argMax(substring(error, greatest(1, length(error) - %d)), created)
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY error_fingerprint
+			ORDER BY c DESC LIMIT %d`, errorSampleBytes-1, w, limit)
+		args = a
+	} else {
+		w, a := chMVWhere(days, repoSource)
+		if app != "" {
+			w += " AND nsapp = ?"
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT error_fingerprint, sum(cnt) c, uniqExact(nsapp),
+				topKWeighted(5)(nsapp, cnt), topKWeighted(1)(exit_code, cnt), topKWeighted(1)(error_category, cnt),
+				min(first_seen), max(last_seen),
+				argMax(sample, last_seen)
+			FROM telemetry_db.mv_daily_error_fingerprint WHERE %s
+			GROUP BY error_fingerprint
+			ORDER BY c DESC LIMIT %d`, w, limit)
+		args = a
+	}
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH error clusters: %w", err)
+	}
+	defer rows.Close()
+
+	data := &ErrorClusterData{Days: days}
+	for rows.Next() {
+		var c ErrorCluster
+		var cnt, apps uint64
+		var codes []int16
+		var cats []string
+		var first, last time.Time
+		if err := rows.Scan(&c.Fingerprint, &cnt, &apps, &c.TopApps, &codes, &cats, &first, &last, &c.Excerpt); err != nil {
+			log.Printf("[CH] error cluster scan: %v", err)
+			continue
+		}
+		c.Count, c.AppCount = int(cnt), int(apps)
+		if len(codes) > 0 {
+			c.ExitCode = int(codes[0])
+		}
+		if len(cats) > 0 {
+			c.Category = cats[0]
+		}
+		c.FirstSeen = first.UTC().Format(time.RFC3339)
+		c.LastSeen = last.UTC().Format(time.RFC3339)
+		data.Clusters = append(data.Clusters, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Share is relative to all fingerprinted errors in the window, not just
+	// the returned clusters.
+	var total uint64
+	var terr error
+	if repoSlug != "" {
+		w, a := chWhere(days, repoSource, repoSlug, "status = 'failed'", "error_category != 'user_aborted'", "exit_code != 0", "error_fingerprint != ''")
+		if app != "" {
+			w += " AND nsapp = ?"
+			a = append(a, app)
+		}
+		terr = ch.db.QueryRowContext(ctx, "SELECT count() FROM telemetry_db.telemetry WHERE "+w, a...).Scan(&total)
+	} else {
+		w, a := chMVWhere(days, repoSource)
+		if app != "" {
+			w += " AND nsapp = ?"
+			a = append(a, app)
+		}
+		terr = ch.db.QueryRowContext(ctx, "SELECT sum(cnt) FROM telemetry_db.mv_daily_error_fingerprint WHERE "+w, a...).Scan(&total)
+	}
+	if terr != nil {
+		return nil, fmt.Errorf("CH error cluster total: %w", terr)
+	}
+	data.TotalErrors = int(total)
+	data.finish()
+	return data, nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  ERROR CLUSTERS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchErrorClusters(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*ErrorClusterData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type acc struct {
+		cluster     ErrorCluster
+		apps        map[string]int
+		codes       map[string]int
+		cats        map[string]int
+		first, last time.Time
+	}
+	groups := make(map[string]*acc)
+	data := &ErrorClusterData{Days: days}
+	for _, r := range m.rows {
+		if !memRealError(r) || r.ErrorFingerprint == "" || !memMatch(r, days, repoSource, repoSlug) ||
+			(app != "" && r.NSAPP != app) {
+			continue
+		}
+		data.TotalErrors++
+		g, ok := groups[r.ErrorFingerprint]
+		if !ok {
+			g = &acc{
+				cluster: ErrorCluster{Fingerprint: r.ErrorFingerprint},
+				apps:    make(map[string]int),
+				codes:   make(map[string]int),
+				cats:    make(map[string]int),
+				first:   r.Created,
+			}
+			groups[r.ErrorFingerprint] = g
+		}
+		g.cluster.Count++
+		g.apps[r.NSAPP]++
+		g.codes[strconv.Itoa(r.ExitCode)]++
+		g.cats[r.ErrorCategory]++
+		if r.Created.Before(g.first) {
+			g.first = r.Created
+		}
+		if !r.Created.Before(g.last) {
+			g.last = r.Created
+			g.cluster.Excerpt = r.Error
+		}
+	}
+
+	for _, g := range groups {
+		c := g.cluster
+		c.AppCount = len(g.apps)
+		c.TopApps = []string{}
+		for _, a := range memTop(g.apps, 5) {
+			c.TopApps = append(c.TopApps, a.Key)
+		}
+		if top := memTop(g.codes, 1); len(top) > 0 {
+			c.ExitCode, _ = strconv.Atoi(top[0].Key)
+		}
+		if top := memTop(g.cats, 1); len(top) > 0 {
+			c.Category = top[0].Key
+		}
+		c.FirstSeen = g.first.UTC().Format(time.RFC3339)
+		c.LastSeen = g.last.UTC().Format(time.RFC3339)
+		data.Clusters = append(data.Clusters, c)
+	}
+	sort.Slice(data.Clusters, func(i, j int) bool {
+		if data.Clusters[i].Count != data.Clusters[j].Count {
+			return data.Clusters[i].Count > data.Clusters[j].Count
+		}
+		return data.Clusters[i].Fingerprint < data.Clusters[j].Fingerprint
+	})
+	if len(data.Clusters) > limit {
+		data.Clusters = data.Clusters[:limit]
+	}
+	data.finish()
+	return data, nil
+}
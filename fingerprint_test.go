@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestNormalizeErrorText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"E: Unable to locate package foo", "e: unable to locate package foo"},
+		{"\x1b[31mERROR\x1b[0m at 2026-03-01T10:11:12Z", "error at <ts>"},
+		{"cannot open /opt/jellyfin/bin/run: No such file", "cannot open <path>: no such file"},
+		{"connect to 192.x.x.4 port 443 failed", "connect to <ip> port <n> failed"},
+		{"node v18.17.1 is too old", "node <ver> is too old"},
+		{"commit 3f2a9c1d not found", "commit <hash> not found"},
+		{"get https://example.com/a?b=1 failed", "get <url> failed"},
+		// Only the last fingerprintLines non-empty lines are kept.
+		{"1\n2\n\nthree\nfour\nfive\nsix\nseven\n", "three\nfour\nfive\nsix\nseven"},
+	}
+	for _, tt := range tests {
+		if got := normalizeErrorText(tt.in); got != tt.want {
+			t.Errorf("normalizeErrorText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestErrorFingerprint(t *testing.T) {
+	same := [][2]string{
+		{
+			"E: Failed to fetch http://deb.debian.org/pool/foo_1.2.3_amd64.deb 404 [IP: 151.x.x.132 80]",
+			"E: Failed to fetch http://ftp.de.debian.org/pool/foo_1.2.4_amd64.deb 404 [IP: 199.x.x.10 80]",
+		},
+		{
+			"[2026-03-01 10:00:00] /tmp/tmp.abc/install.sh: line 42: npm: command not found",
+			"[2026-04-11 23:59:59] /tmp/tmp.xyz/install.sh: line 57: npm: command not found",
+		},
+		{
+			"Setting up app v1.2.3\nError: build failed after 120s",
+			"Setting up app v2.0.0-rc1\nError: build failed after 95s",
+		},
+		{
+			"container 8f3e2a1b-1c2d-4e5f-8a9b-0c1d2e3f4a5b exited with code 1",
+			"container 0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d exited with code 137",
+		},
+	}
+	for _, p := range same {
+		a, b := errorFingerprint(p[0]), errorFingerprint(p[1])
+		if a == "" || a != b {
+			t.Errorf("fingerprints differ:\n  %q -> %s\n  %q -> %s", p[0], a, p[1], b)
+		}
+	}
+
+	different := [][2]string{
+		{"E: Unable to locate package foo", "E: Unable to locate package bar"},
+		{"npm: command not found", "curl: command not found"},
+		{"No space left on device", "Out of memory: Killed process"},
+	}
+	for _, p := range different {
+		if a, b := errorFingerprint(p[0]), errorFingerprint(p[1]); a == b {
+			t.Errorf("%q and %q share fingerprint %s", p[0], p[1], a)
+		}
+	}
+
+	if fp := errorFingerprint(" \n\t\n"); fp != "" {
+		t.Errorf("fingerprint of blank log = %q, want empty", fp)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ---------- Fork analytics ----------
+// Installs carry the owner/repo slug they were run from. Per fork this reports
+// when it was first and last seen, its volume against the previous window, its
+// success rate against upstream (overall and per app, where a significant
+// difference means the fork fixes or breaks a script) and the apps only the
+// fork installed. Forks first seen within forkNewDays are flagged as new.
+
+// upstreamRepoSlug is the slug the forks are compared against.
+const upstreamRepoSlug = "community-scripts/ProxmoxVE"
+
+const (
+	// forkNewDays is how recently a fork must have been first seen to be new.
+	forkNewDays = 7
+	// forkMinSamples is the number of finished fork installs of an app needed
+	// to compare it with upstream.
+	forkMinSamples = 5
+	// forkLimit caps the number of forks returned.
+	forkLimit = 50
+)
+
+// ForkAppDiff is an app whose success rate in a fork differs significantly
+// from upstream. Verdict is "fixes" (fork fails less) or "breaks".
+type ForkAppDiff struct {
+	App          string  `json:"app"`
+	Installs     int     `json:"installs"`
+	SuccessRate  float64 `json:"success_rate"`
+	UpstreamRate float64 `json:"upstream_rate"`
+	ZScore       float64 `json:"z_score"`
+	Verdict      string  `json:"verdict"`
+}
+
+// ForkStat describes one repo_slug. FirstSeen/LastSeen cover all data, the
+// counts the requested window; PrevInstalls is the window before it.
+type ForkStat struct {
+	Slug         string        `json:"slug"`
+	FirstSeen    string        `json:"first_seen"`
+	LastSeen     string        `json:"last_seen"`
+	New          bool          `json:"new"`
+	Installs     int           `json:"installs"`
+	PrevInstalls int           `json:"prev_installs"`
+	TrendPercent float64       `json:"trend_percent"`
+	Success      int           `json:"success"`
+	Failed       int           `json:"failed"`
+	SuccessRate  float64       `json:"success_rate"`
+	ZScore       float64       `json:"z_score,omitempty"`
+	Apps         int           `json:"apps"`
+	UniqueApps   []string      `json:"unique_apps"`
+	AppDiffs     []ForkAppDiff `json:"app_diffs"`
+}
+
+// ForkData is the response of /api/forks.
+type ForkData struct {
+	Days     int        `json:"days"`
+	Upstream ForkStat   `json:"upstream"`
+	Forks    []ForkStat `json:"forks"`
+	NewForks []string   `json:"new_forks"`
+}
+
+// forkCount is one (repo_slug, nsapp) aggregate: installs, finished outcomes
+// in the window and installs in the previous window.
+type forkCount struct {
+	slug, app              string
+	total, success, failed int
+	prev                   int
+}
+
+// forkSeen is the first and last install of a slug.
+type forkSeen struct {
+	first, last time.Time
+}
+
+// buildForkData assembles the response. An app is unique to a fork when
+// upstream had no installs of it in the same window.
+func buildForkData(days int, counts []forkCount, seen map[string]forkSeen) *ForkData {
+	type slugAcc struct {
+		stat ForkStat
+		apps map[string]forkCount
+	}
+	slugs := make(map[string]*slugAcc)
+	for _, c := range counts {
+		s, ok := slugs[c.slug]
+		if !ok {
+			s = &slugAcc{stat: ForkStat{Slug: c.slug}, apps: make(map[string]forkCount)}
+			slugs[c.slug] = s
+		}
+		s.stat.Installs += c.total
+		s.stat.PrevInstalls += c.prev
+		s.stat.Success += c.success
+		s.stat.Failed += c.failed
+		if c.total > 0 {
+			s.apps[c.app] = c
+		}
+	}
+
+	newSince := time.Now().UTC().AddDate(0, 0, -forkNewDays)
+	finish := func(st *ForkStat) {
+		if fs, ok := seen[st.Slug]; ok {
+			st.FirstSeen = fs.first.UTC().Format(time.RFC3339)
+			st.LastSeen = fs.last.UTC().Format(time.RFC3339)
+			st.New = st.Slug != upstreamRepoSlug && fs.first.After(newSince)
+		}
+		if st.PrevInstalls > 0 {
+			st.TrendPercent = float64(st.Installs-st.PrevInstalls) / float64(st.PrevInstalls) * 100
+		}
+		if n := st.Success + st.Failed; n > 0 {
+			st.SuccessRate = float64(st.Success) / float64(n) * 100
+		}
+		if st.UniqueApps == nil {
+			st.UniqueApps = []string{}
+		}
+		if st.AppDiffs == nil {
+			st.AppDiffs = []ForkAppDiff{}
+		}
+	}
+
+	data := &ForkData{Days: days, Upstream: ForkStat{Slug: upstreamRepoSlug}, Forks: []ForkStat{}, NewForks: []string{}}
+	up := slugs[upstreamRepoSlug]
+	if up != nil {
+		data.Upstream = up.stat
+		data.Upstream.Apps = len(up.apps)
+	}
+	finish(&data.Upstream)
+	upN := data.Upstream.Success + data.Upstream.Failed
+
+	for slug, s := range slugs {
+		if slug == upstreamRepoSlug || (s.stat.Installs == 0 && s.stat.PrevInstalls == 0) {
+			continue
+		}
+		st := s.stat
+		st.Apps = len(s.apps)
+		if n := st.Success + st.Failed; n >= forkMinSamples && upN >= compatMinSamples {
+			st.ZScore = proportionZ(data.Upstream.Failed, upN, st.Failed, n)
+		}
+		for app, c := range s.apps {
+			var u forkCount
+			if up != nil {
+				u = up.apps[app]
+			}
+			if u.total == 0 {
+				st.UniqueApps = append(st.UniqueApps, app)
+				continue
+			}
+			n, un := c.success+c.failed, u.success+u.failed
+			if n < forkMinSamples || un < compatMinSamples {
+				continue
+			}
+			z := proportionZ(u.failed, un, c.failed, n)
+			verdict := ""
+			switch {
+			case z >= compatFlagZ:
+				verdict = "breaks"
+			case z <= -compatFlagZ:
+				verdict = "fixes"
+			default:
+				continue
+			}
+			st.AppDiffs = append(st.AppDiffs, ForkAppDiff{
+				App:          app,
+				Installs:     c.total,
+				SuccessRate:  float64(c.success) / float64(n) * 100,
+				UpstreamRate: float64(u.success) / float64(un) * 100,
+				ZScore:       z,
+				Verdict:      verdict,
+			})
+		}
+		sort.Strings(st.UniqueApps)
+		sort.Slice(st.AppDiffs, func(i, j int) bool { return st.AppDiffs[i].App < st.AppDiffs[j].App })
+		finish(&st)
+		data.Forks = append(data.Forks, st)
+	}
+	sort.Slice(data.Forks, func(i, j int) bool {
+		if data.Forks[i].Installs != data.Forks[j].Installs {
+			return data.Forks[i].Installs > data.Forks[j].Installs
+		}
+		return data.Forks[i].Slug < data.Forks[j].Slug
+	})
+	if len(data.Forks) > forkLimit {
+		data.Forks = data.Forks[:forkLimit]
+	}
+	for slug, fs := range seen {
+		if slug != upstreamRepoSlug && fs.first.After(newSince) {
+			data.NewForks = append(data.NewForks, slug)
+		}
+	}
+	sort.Strings(data.NewForks)
+	return data
+}
+
+// ══════════════════════════════════════════════════════════════
+//  FORKS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchForkStats(ctx context.Context, days int, repoSource string) (*ForkData, error) {
+	since := chSinceTime(days)
+
+	// First/last seen cover all data, so they come from mv_repo_slug_seen
+	// (one row per slug) instead of the raw table.
+	sw, sa := "1=1", []interface{}(nil)
+	if pred, pArgs := repoSourcePred(repoSource); pred != "" {
+		sw, sa = pred, pArgs
+	}
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT repo_slug, min(first_seen), max(last_seen)
+		FROM telemetry_db.mv_repo_slug_seen WHERE %s
+		GROUP BY repo_slug`, sw), sa...)
+	if err != nil {
+		return nil, fmt.Errorf("CH fork first/last seen: %w", err)
+	}
+	seen := make(map[string]forkSeen)
+	for rows.Next() {
+		var slug string
+		var fs forkSeen
+		if err := rows.Scan(&slug, &fs.first, &fs.last); err != nil {
+			log.Printf("[CH] fork seen scan: %v", err)
+			continue
+		}
+		seen[slug] = fs
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Current and previous window in one pass.
+	w, wArgs := chWhere(2*days, repoSource, "", "repo_slug != ''", "status IN ('success','failed','aborted','unknown')")
+	args := append([]interface{}{since, since, since, since}, wArgs...)
+	rows, err = ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT repo_slug, nsapp,
+			countIf(created >= ?), countIf(created >= ? AND status='success'), countIf(created >= ? AND status='failed'),
+			countIf(created < ?)
+		FROM telemetry_db.telemetry WHERE %s
+		GROUP BY repo_slug, nsapp`, w), args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH fork stats: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []forkCount
+	for rows.Next() {
+		var c forkCount
+		var total, success, failed, prev uint64
+		if err := rows.Scan(&c.slug, &c.app, &total, &success, &failed, &prev); err != nil {
+			log.Printf("[CH] fork stats scan: %v", err)
+			continue
+		}
+		c.total, c.success, c.failed, c.prev = int(total), int(success), int(failed), int(prev)
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildForkData(days, counts, seen), nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  FORKS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchForkStats(ctx context.Context, days int, repoSource string) (*ForkData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	since := chSinceTime(days)
+	prevSince := chSinceTime(2 * days)
+	seen := make(map[string]forkSeen)
+	groups := make(map[[2]string]*forkCount)
+	for _, r := range m.rows {
+		if r.RepoSlug == "" || !memRepoMatch(r, repoSource) {
+			continue
+		}
+		fs, ok := seen[r.RepoSlug]
+		if !ok || r.Created.Before(fs.first) {
+			fs.first = r.Created
+		}
+		if r.Created.After(fs.last) {
+			fs.last = r.Created
+		}
+		seen[r.RepoSlug] = fs
+
+		if !isTerminalStatus(r.Status) || r.Created.Before(prevSince) {
+			continue
+		}
+		key := [2]string{r.RepoSlug, r.NSAPP}
+		c, ok := groups[key]
+		if !ok {
+			c = &forkCount{slug: r.RepoSlug, app: r.NSAPP}
+			groups[key] = c
+		}
+		if r.Created.Before(since) {
+			c.prev++
+			continue
+		}
+		c.total++
+		switch r.Status {
+		case "success":
+			c.success++
+		case "failed":
+			c.failed++
+		}
+	}
+
+	counts := make([]forkCount, 0, len(groups))
+	for _, c := range groups {
+		counts = append(counts, *c)
+	}
+	return buildForkData(days, counts, seen), nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Installation funnel ----------
+// Every execution_id reports installing → validation → configuring → a
+// terminal status. Aggregating those sequences shows how far executions get,
+// where they stop (failed, aborted, never reported) and how long each stage
+// takes, i.e. whether failures come from container creation or from the
+// in-container configuration.
+
+// funnelStages are the progress stages in order. Stage index 0 in the
+// aggregates means "no progress event was received".
+var funnelStages = []string{"installing", "validation", "configuring"}
+
+// funnelAppLimit caps the number of per-app funnels returned.
+const funnelAppLimit = 100
+
+// FunnelStage is the number of executions that reached a stage (or a later one).
+type FunnelStage struct {
+	Stage   string  `json:"stage"`
+	Reached int     `json:"reached"`
+	Rate    float64 `json:"rate"`
+}
+
+// FunnelDropOff counts executions that ended with Outcome after their last
+// progress stage. Outcome is failed, aborted, no_report (marked unknown by the
+// cleanup job) or in_progress (no terminal event yet).
+type FunnelDropOff struct {
+	After   string `json:"after"`
+	Outcome string `json:"outcome"`
+	Count   int    `json:"count"`
+}
+
+// FunnelTimings holds median seconds between stages.
+type FunnelTimings struct {
+	InstallingToValidation  float64 `json:"installing_to_validation"`
+	ValidationToConfiguring float64 `json:"validation_to_configuring"`
+	ConfiguringToDone       float64 `json:"configuring_to_done"`
+	Total                   float64 `json:"total"`
+}
+
+// FunnelStats is the funnel of one app (or of all apps when App is empty).
+type FunnelStats struct {
+	App        string          `json:"app,omitempty"`
+	Executions int             `json:"executions"`
+	Stages     []FunnelStage   `json:"stages"`
+	Succeeded  int             `json:"succeeded"`
+	DropOff    []FunnelDropOff `json:"drop_off"`
+	Median     FunnelTimings   `json:"median_seconds"`
+}
+
+// FunnelData is the response of /api/funnel.
+type FunnelData struct {
+	Days    int           `json:"days"`
+	Overall FunnelStats   `json:"overall"`
+	Apps    []FunnelStats `json:"apps"`
+}
+
+// funnelOutcome maps the terminal status of an execution to its outcome label.
+func funnelOutcome(status string) string {
+	switch status {
+	case "":
+		return "in_progress"
+	case "unknown":
+		return "no_report"
+	}
+	return status
+}
+
+// newFunnelStats builds the funnel from per-(stage, outcome) execution counts,
+// keyed "stage:status" with stage 0..3 and the raw terminal status.
+func newFunnelStats(app string, executions int, counts map[string]int, median FunnelTimings) FunnelStats {
+	fs := FunnelStats{App: app, Executions: executions, Median: median, DropOff: []FunnelDropOff{}}
+	reached := make([]int, len(funnelStages)+1)
+	drops := make(map[[2]string]int)
+	for key, c := range counts {
+		i := strings.IndexByte(key, ':')
+		if i < 0 {
+			continue
+		}
+		stage, err := strconv.Atoi(key[:i])
+		if err != nil || stage < 0 || stage > len(funnelStages) {
+			continue
+		}
+		for s := 1; s <= stage; s++ {
+			reached[s] += c
+		}
+		outcome := funnelOutcome(key[i+1:])
+		if outcome == "success" {
+			fs.Succeeded += c
+			continue
+		}
+		after := "start"
+		if stage > 0 {
+			after = funnelStages[stage-1]
+		}
+		drops[[2]string{after, outcome}] += c
+	}
+	for s, name := range funnelStages {
+		st := FunnelStage{Stage: name, Reached: reached[s+1]}
+		if executions > 0 {
+			st.Rate = float64(st.Reached) / float64(executions) * 100
+		}
+		fs.Stages = append(fs.Stages, st)
+	}
+
+	order := map[string]int{"start": 0}
+	for i, name := range funnelStages {
+		order[name] = i + 1
+	}
+	for k, c := range drops {
+		fs.DropOff = append(fs.DropOff, FunnelDropOff{After: k[0], Outcome: k[1], Count: c})
+	}
+	sort.Slice(fs.DropOff, func(i, j int) bool {
+		a, b := fs.DropOff[i], fs.DropOff[j]
+		if order[a.After] != order[b.After] {
+			return order[a.After] < order[b.After]
+		}
+		return a.Outcome < b.Outcome
+	})
+	return fs
+}
+
+// finiteOrZero replaces NaN/Inf (empty quantiles) so the value can be encoded.
+func finiteOrZero(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// ══════════════════════════════════════════════════════════════
+//  FUNNEL (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchFunnel(ctx context.Context, days int, repoSource, repoSlug, app string) (*FunnelData, error) {
+	extras := []string{"execution_id != ''",
+		"status IN ('installing','validation','configuring','success','failed','aborted','unknown')"}
+	if app != "" {
+		extras = append(extras, "nsapp = ?")
+	}
+	w, args := chWhere(days, repoSource, repoSlug, extras...)
+	if app != "" {
+		args = append(args, app)
+	}
+
+	// Inner query: one row per execution with the first timestamp of every
+	// stage and its terminal status (a real outcome wins over "unknown").
+	// Outer query: funnel counts and stage medians per app, plus the overall
+	// row from WITH ROLLUP (nsapp = '').
+	query := fmt.Sprintf(`
+		SELECT nsapp, count() n,
+			tupleElement(sumMap([concat(toString(multiIf(hc, 3, hv, 2, hi, 1, 0)), ':', outcome)], [toUInt64(1)]), 1) AS keys,
+			tupleElement(sumMap([concat(toString(multiIf(hc, 3, hv, 2, hi, 1, 0)), ':', outcome)], [toUInt64(1)]), 2) AS vals,
+			quantileIf(0.5)(dateDiff('second', ti, tv), hi AND hv AND tv >= ti),
+			quantileIf(0.5)(dateDiff('second', tv, tc), hv AND hc AND tc >= tv),
+			quantileIf(0.5)(dateDiff('second', tc, tt), hc AND ht AND tt >= tc),
+			quantileIf(0.5)(dateDiff('second', ti, tt), hi AND ht AND tt >= ti)
+		FROM (
+			SELECT nsapp, execution_id,
+				countIf(status = 'installing') > 0  AS hi,
+				countIf(status = 'validation') > 0  AS hv,
+				countIf(status = 'configuring') > 0 AS hc,
+				countIf(status IN ('success','failed','aborted')) > 0 AS ht,
+				minIf(created, status = 'installing')  AS ti,
+				minIf(created, status = 'validation')  AS tv,
+				minIf(created, status = 'configuring') AS tc,
+				minIf(created, status IN ('success','failed','aborted')) AS tt,
+				if(ht, argMinIf(status, created, status IN ('success','failed','aborted')),
+					if(countIf(status = 'unknown') > 0, 'unknown', '')) AS outcome
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY nsapp, execution_id
+		)
+		GROUP BY nsapp WITH ROLLUP
+		ORDER BY n DESC
+		LIMIT %d`, w, funnelAppLimit+1)
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH funnel: %w", err)
+	}
+	defer rows.Close()
+
+	data := &FunnelData{Days: days, Apps: []FunnelStats{}}
+	for rows.Next() {
+		var nsapp string
+		var n uint64
+		var keys []string
+		var vals []uint64
+		var m FunnelTimings
+		if err := rows.Scan(&nsapp, &n, &keys, &vals,
+			&m.InstallingToValidation, &m.ValidationToConfiguring, &m.ConfiguringToDone, &m.Total); err != nil {
+			log.Printf("[CH] funnel scan: %v", err)
+			continue
+		}
+		m.InstallingToValidation = finiteOrZero(m.InstallingToValidation)
+		m.ValidationToConfiguring = finiteOrZero(m.ValidationToConfiguring)
+		m.ConfiguringToDone = finiteOrZero(m.ConfiguringToDone)
+		m.Total = finiteOrZero(m.Total)
+
+		counts := make(map[string]int, len(keys))
+		for i, k := range keys {
+			if i < len(vals) {
+				counts[k] = int(vals[i])
+			}
+		}
+		fs := newFunnelStats(nsapp, int(n), counts, m)
+		if nsapp == "" {
+			data.Overall = fs
+		} else if len(data.Apps) < funnelAppLimit {
+			data.Apps = append(data.Apps, fs)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if data.Overall.Stages == nil {
+		data.Overall = newFunnelStats("", 0, nil, FunnelTimings{})
+	}
+	return data, nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  FUNNEL (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchFunnel(ctx context.Context, days int, repoSource, repoSlug, app string) (*FunnelData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// First timestamp per stage (index 0 = terminal, 1..3 = funnelStages).
+	type execution struct {
+		app     string
+		first   [4]time.Time
+		status  string
+		unknown bool
+	}
+	execs := make(map[string]*execution)
+	for _, r := range m.rows {
+		if r.ExecutionID == "" || !memMatch(r, days, repoSource, repoSlug) || (app != "" && r.NSAPP != app) {
+			continue
+		}
+		idx := -1
+		switch r.Status {
+		case "installing":
+			idx = 1
+		case "validation":
+			idx = 2
+		case "configuring":
+			idx = 3
+		case "success", "failed", "aborted":
+			idx = 0
+		case "unknown":
+		default:
+			continue
+		}
+		e, ok := execs[r.ExecutionID]
+		if !ok {
+			e = &execution{app: r.NSAPP}
+			execs[r.ExecutionID] = e
+		}
+		if idx < 0 {
+			e.unknown = true
+			continue
+		}
+		if e.first[idx].IsZero() || r.Created.Before(e.first[idx]) {
+			e.first[idx] = r.Created
+			if idx == 0 {
+				e.status = r.Status
+			}
+		}
+	}
+
+	type group struct {
+		n      int
+		counts map[string]int
+		diffs  [4][]int
+	}
+	groups := map[string]*group{"": {counts: make(map[string]int)}}
+	for _, e := range execs {
+		stage := 0
+		for s := 3; s >= 1; s-- {
+			if !e.first[s].IsZero() {
+				stage = s
+				break
+			}
+		}
+		status := e.status
+		if status == "" && e.unknown {
+			status = "unknown"
+		}
+		key := strconv.Itoa(stage) + ":" + status
+
+		targets := []*group{groups[""]}
+		if e.app != "" {
+			g, ok := groups[e.app]
+			if !ok {
+				g = &group{counts: make(map[string]int)}
+				groups[e.app] = g
+			}
+			targets = append(targets, g)
+		}
+		for _, gg := range targets {
+			gg.n++
+			gg.counts[key]++
+			for i, p := range [][2]int{{1, 2}, {2, 3}, {3, 0}, {1, 0}} {
+				from, to := e.first[p[0]], e.first[p[1]]
+				if !from.IsZero() && !to.IsZero() && !to.Before(from) {
+					gg.diffs[i] = append(gg.diffs[i], int(to.Sub(from).Seconds()))
+				}
+			}
+		}
+	}
+
+	median := func(vals []int) float64 {
+		sort.Ints(vals)
+		return percentile(vals, 0.5)
+	}
+	build := func(name string, g *group) FunnelStats {
+		return newFunnelStats(name, g.n, g.counts, FunnelTimings{
+			InstallingToValidation:  median(g.diffs[0]),
+			ValidationToConfiguring: median(g.diffs[1]),
+			ConfiguringToDone:       median(g.diffs[2]),
+			Total:                   median(g.diffs[3]),
+		})
+	}
+
+	data := &FunnelData{Days: days, Overall: build("", groups[""]), Apps: []FunnelStats{}}
+	for name, g := range groups {
+		if name != "" {
+			data.Apps = append(data.Apps, build(name, g))
+		}
+	}
+	sort.Slice(data.Apps, func(i, j int) bool {
+		if data.Apps[i].Executions != data.Apps[j].Executions {
+			return data.Apps[i].Executions > data.Apps[j].Executions
+		}
+		return data.Apps[i].App < data.Apps[j].App
+	})
+	if len(data.Apps) > funnelAppLimit {
+		data.Apps = data.Apps[:funnelAppLimit]
+	}
+	return data, nil
+}
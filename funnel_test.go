@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewFunnelStats(t *testing.T) {
+	counts := map[string]int{
+		"3:success": 5,
+		"3:failed":  2,
+		"3:unknown": 1,
+		"2:":        1,
+		"1:failed":  1,
+		"0:aborted": 1,
+		"bogus":     7,
+		"9:failed":  7,
+	}
+	fs := newFunnelStats("jellyfin", 11, counts, FunnelTimings{Total: 90})
+
+	if fs.App != "jellyfin" || fs.Executions != 11 || fs.Succeeded != 5 || fs.Median.Total != 90 {
+		t.Errorf("funnel = %+v", fs)
+	}
+	wantStages := []FunnelStage{
+		{Stage: "installing", Reached: 10, Rate: float64(10) / 11 * 100},
+		{Stage: "validation", Reached: 9, Rate: float64(9) / 11 * 100},
+		{Stage: "configuring", Reached: 8, Rate: float64(8) / 11 * 100},
+	}
+	if !reflect.DeepEqual(fs.Stages, wantStages) {
+		t.Errorf("stages = %+v, want %+v", fs.Stages, wantStages)
+	}
+	wantDrops := []FunnelDropOff{
+		{After: "start", Outcome: "aborted", Count: 1},
+		{After: "installing", Outcome: "failed", Count: 1},
+		{After: "validation", Outcome: "in_progress", Count: 1},
+		{After: "configuring", Outcome: "failed", Count: 2},
+		{After: "configuring", Outcome: "no_report", Count: 1},
+	}
+	if !reflect.DeepEqual(fs.DropOff, wantDrops) {
+		t.Errorf("drop-offs = %+v, want %+v", fs.DropOff, wantDrops)
+	}
+}
+
+func TestNewFunnelStatsEmpty(t *testing.T) {
+	fs := newFunnelStats("", 0, nil, FunnelTimings{})
+	if len(fs.Stages) != len(funnelStages) || len(fs.DropOff) != 0 {
+		t.Fatalf("empty funnel = %+v", fs)
+	}
+	for _, s := range fs.Stages {
+		if s.Reached != 0 || s.Rate != 0 {
+			t.Errorf("stage %s = %+v, want zero", s.Stage, s)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ---------- Hardware insights ----------
+// Outcomes by GPU passthrough mode × vendor (and GPU family), by normalized CPU
+// family, and arm64 vs x86 per app. Groups whose failure rate is significantly
+// above the rest of their section are flagged, e.g. Intel Arc passthrough or
+// the arm64 build of one script failing disproportionately.
+
+// hardwareMinSamples is the number of finished installs a group (and the rest
+// of its section) needs before it can be flagged.
+const hardwareMinSamples = 10
+
+// HardwareOutcome counts finished installs; FailureRate is failed/(success+failed).
+type HardwareOutcome struct {
+	Total       int     `json:"total"`
+	Success     int     `json:"success"`
+	Failed      int     `json:"failed"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+func (o *HardwareOutcome) add(total, success, failed int) {
+	o.Total += total
+	o.Success += success
+	o.Failed += failed
+}
+
+func (o *HardwareOutcome) finish() {
+	if n := o.Success + o.Failed; n > 0 {
+		o.FailureRate = float64(o.Failed) / float64(n) * 100
+	}
+}
+
+// HardwareStat is one hardware group.
+type HardwareStat struct {
+	Key string `json:"key"`
+	HardwareOutcome
+	ZScore  float64 `json:"z_score,omitempty"`
+	Flagged bool    `json:"flagged"`
+}
+
+// ArchStat compares arm64 and x86 installs of one app.
+type ArchStat struct {
+	App     string          `json:"app"`
+	Arm     HardwareOutcome `json:"arm"`
+	X86     HardwareOutcome `json:"x86"`
+	ZScore  float64         `json:"z_score,omitempty"`
+	Flagged bool            `json:"flagged"`
+}
+
+// HardwareData is the response of /api/hardware.
+type HardwareData struct {
+	Days        int            `json:"days"`
+	GPU         []HardwareStat `json:"gpu"`
+	GPUFamilies []HardwareStat `json:"gpu_families"`
+	CPUFamilies []HardwareStat `json:"cpu_families"`
+	Arch        []ArchStat     `json:"arch"`
+}
+
+// hwCount is one raw aggregate row (keys depend on the section).
+type hwCount struct {
+	k1, k2, k3             string
+	total, success, failed int
+}
+
+var (
+	cpuIntelUltraRe = regexp.MustCompile(`core(?:\(tm\))?\s*ultra`)
+	cpuIntelCoreRe  = regexp.MustCompile(`core\(tm\)\s*(i[3579])|core\s+(i[3579])`)
+	cpuRyzenRe      = regexp.MustCompile(`ryzen\s*(?:ai\s*)?(\d)`)
+	cpuCortexRe     = regexp.MustCompile(`cortex-?(a\d+)`)
+	cpuAppleRe      = regexp.MustCompile(`apple\s+(m\d)`)
+	cpuIntelNRe     = regexp.MustCompile(`\bn(50|95|97|100|150|200|250|300|305|355)\b`)
+	gpuIntelArcRe   = regexp.MustCompile(`\barc\b`)
+)
+
+// cpuFamily normalizes a CPU model string to its family ("Intel Core i7",
+// "AMD Ryzen 5", "Intel N-series", ...). Unrecognized models fall back to the
+// vendor; "" means nothing usable was reported.
+func cpuFamily(vendor, model string) string {
+	m := strings.ToLower(model)
+	switch {
+	case cpuIntelUltraRe.MatchString(m):
+		return "Intel Core Ultra"
+	case cpuIntelCoreRe.MatchString(m):
+		sm := cpuIntelCoreRe.FindStringSubmatch(m)
+		return "Intel Core " + sm[1] + sm[2]
+	case strings.Contains(m, "xeon"):
+		return "Intel Xeon"
+	case cpuIntelNRe.MatchString(m):
+		return "Intel N-series"
+	case strings.Contains(m, "celeron"):
+		return "Intel Celeron"
+	case strings.Contains(m, "pentium"):
+		return "Intel Pentium"
+	case strings.Contains(m, "atom"):
+		return "Intel Atom"
+	case strings.Contains(m, "epyc"):
+		return "AMD EPYC"
+	case strings.Contains(m, "threadripper"):
+		return "AMD Threadripper"
+	case cpuRyzenRe.MatchString(m):
+		return "AMD Ryzen " + cpuRyzenRe.FindStringSubmatch(m)[1]
+	case strings.Contains(m, "athlon"):
+		return "AMD Athlon"
+	case cpuAppleRe.MatchString(m):
+		return "Apple " + strings.ToUpper(cpuAppleRe.FindStringSubmatch(m)[1])
+	case cpuCortexRe.MatchString(m):
+		return "ARM Cortex-" + strings.ToUpper(cpuCortexRe.FindStringSubmatch(m)[1])
+	case strings.Contains(m, "neoverse"):
+		return "ARM Neoverse"
+	}
+	return vendorLabel(vendor)
+}
+
+// gpuFamily normalizes a GPU model string to its family ("Intel Arc",
+// "NVIDIA GeForce RTX", ...), falling back to the vendor.
+func gpuFamily(vendor, model string) string {
+	m := strings.ToLower(model)
+	switch {
+	case gpuIntelArcRe.MatchString(m):
+		return "Intel Arc"
+	case strings.Contains(m, "iris"):
+		return "Intel Iris"
+	case strings.Contains(m, "uhd") || strings.Contains(m, "hd graphics"):
+		return "Intel UHD/HD"
+	case strings.Contains(m, "rtx"):
+		return "NVIDIA GeForce RTX"
+	case strings.Contains(m, "gtx"):
+		return "NVIDIA GeForce GTX"
+	case strings.Contains(m, "quadro") || strings.Contains(m, "tesla") || strings.Contains(m, "nvidia a"):
+		return "NVIDIA Workstation"
+	case strings.Contains(m, "radeon") && (strings.Contains(m, "rx") || strings.Contains(m, "pro")):
+		return "AMD Radeon (discrete)"
+	case strings.Contains(m, "radeon") || strings.Contains(m, "vega"):
+		return "AMD Radeon (integrated)"
+	}
+	return vendorLabel(vendor)
+}
+
+// vendorLabel is the display name of a vendor value ("" for unknown).
+func vendorLabel(vendor string) string {
+	switch vendor {
+	case "", "unknown":
+		return ""
+	case "amd":
+		return "AMD"
+	case "nvidia":
+		return "NVIDIA"
+	case "arm":
+		return "ARM"
+	}
+	return strings.ToUpper(vendor[:1]) + vendor[1:]
+}
+
+// hardwareStats merges counts into groups, flags groups against the rest of
+// the section and orders them by volume.
+func hardwareStats(groups map[string]*HardwareOutcome) []HardwareStat {
+	var section HardwareOutcome
+	for _, g := range groups {
+		section.add(g.Total, g.Success, g.Failed)
+	}
+	out := []HardwareStat{}
+	for key, g := range groups {
+		g.finish()
+		s := HardwareStat{Key: key, HardwareOutcome: *g}
+		n := g.Success + g.Failed
+		restN := section.Success + section.Failed - n
+		if n >= hardwareMinSamples && restN >= hardwareMinSamples {
+			s.ZScore = proportionZ(section.Failed-g.Failed, restN, g.Failed, n)
+			s.Flagged = s.ZScore >= compatFlagZ
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// buildHardwareData assembles the response from the raw aggregates:
+// gpu (passthrough, vendor, model), cpu (vendor, model, _) and arch
+// (nsapp, "1"/"0" for has_arm, _). Only apps with arm64 installs are listed
+// in Arch.
+func buildHardwareData(days int, gpu, cpu, arch []hwCount) *HardwareData {
+	data := &HardwareData{Days: days, Arch: []ArchStat{}}
+
+	addTo := func(groups map[string]*HardwareOutcome, key string, c hwCount) {
+		g, ok := groups[key]
+		if !ok {
+			g = &HardwareOutcome{}
+			groups[key] = g
+		}
+		g.add(c.total, c.success, c.failed)
+	}
+	orUnknown := func(s string) string {
+		if s == "" {
+			return "Unknown"
+		}
+		return s
+	}
+
+	gpuGroups := make(map[string]*HardwareOutcome)
+	familyGroups := make(map[string]*HardwareOutcome)
+	for _, c := range gpu {
+		addTo(gpuGroups, c.k1+" / "+orUnknown(vendorLabel(c.k2)), c)
+		addTo(familyGroups, c.k1+" / "+orUnknown(gpuFamily(c.k2, c.k3)), c)
+	}
+	data.GPU = hardwareStats(gpuGroups)
+	data.GPUFamilies = hardwareStats(familyGroups)
+
+	cpuGroups := make(map[string]*HardwareOutcome)
+	for _, c := range cpu {
+		if key := cpuFamily(c.k1, c.k2); key != "" {
+			addTo(cpuGroups, key, c)
+		}
+	}
+	data.CPUFamilies = hardwareStats(cpuGroups)
+
+	apps := make(map[string]*ArchStat)
+	for _, c := range arch {
+		a, ok := apps[c.k1]
+		if !ok {
+			a = &ArchStat{App: c.k1}
+			apps[c.k1] = a
+		}
+		if c.k2 == "1" {
+			a.Arm.add(c.total, c.success, c.failed)
+		} else {
+			a.X86.add(c.total, c.success, c.failed)
+		}
+	}
+	for _, a := range apps {
+		if a.Arm.Total == 0 {
+			continue
+		}
+		a.Arm.finish()
+		a.X86.finish()
+		n, nx := a.Arm.Success+a.Arm.Failed, a.X86.Success+a.X86.Failed
+		if n >= hardwareMinSamples && nx >= hardwareMinSamples {
+			a.ZScore = proportionZ(a.X86.Failed, nx, a.Arm.Failed, n)
+			a.Flagged = a.ZScore >= compatFlagZ
+		}
+		data.Arch = append(data.Arch, *a)
+	}
+	sort.Slice(data.Arch, func(i, j int) bool {
+		if data.Arch[i].Arm.Total != data.Arch[j].Arm.Total {
+			return data.Arch[i].Arm.Total > data.Arch[j].Arm.Total
+		}
+		return data.Arch[i].App < data.Arch[j].App
+	})
+	return data
+}
+
+// ══════════════════════════════════════════════════════════════
+//  HARDWARE INSIGHTS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchHardwareStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*HardwareData, error) {
+	where := func(extra ...string) (string, []interface{}) {
+		extras := append([]string{"status IN ('success','failed','aborted','unknown')"}, extra...)
+		if app != "" {
+			extras = append(extras, "nsapp = ?")
+		}
+		w, a := chWhere(days, repoSource, repoSlug, extras...)
+		if app != "" {
+			a = append(a, app)
+		}
+		return w, a
+	}
+	query := func(keys string, extra ...string) ([]hwCount, error) {
+		w, a := where(extra...)
+		rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT %s, count(), countIf(status='success'), countIf(status='failed')
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY %s LIMIT 10000`, keys, w, keys), a...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out []hwCount
+		for rows.Next() {
+			var c hwCount
+			var total, success, failed uint64
+			if err := rows.Scan(&c.k1, &c.k2, &c.k3, &total, &success, &failed); err != nil {
+				log.Printf("[CH] hardware scan: %v", err)
+				continue
+			}
+			c.total, c.success, c.failed = int(total), int(success), int(failed)
+			out = append(out, c)
+		}
+		return out, rows.Err()
+	}
+
+	gpu, err := query("gpu_passthrough, gpu_vendor, gpu_model", "gpu_passthrough IN ('igpu','dgpu','vgpu')")
+	if err != nil {
+		return nil, fmt.Errorf("CH hardware gpu: %w", err)
+	}
+	cpu, err := query("cpu_vendor, cpu_model, ''", "(cpu_model != '' OR cpu_vendor NOT IN ('','unknown'))")
+	if err != nil {
+		return nil, fmt.Errorf("CH hardware cpu: %w", err)
+	}
+	arch, err := query("nsapp, toString(has_arm), ''")
+	if err != nil {
+		return nil, fmt.Errorf("CH hardware arch: %w", err)
+	}
+	return buildHardwareData(days, gpu, cpu, arch), nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  HARDWARE INSIGHTS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchHardwareStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*HardwareData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := map[string]map[[3]string]*hwCount{"gpu": {}, "cpu": {}, "arch": {}}
+	add := func(section string, key [3]string, r memRow) {
+		c, ok := counts[section][key]
+		if !ok {
+			c = &hwCount{k1: key[0], k2: key[1], k3: key[2]}
+			counts[section][key] = c
+		}
+		c.total++
+		switch r.Status {
+		case "success":
+			c.success++
+		case "failed":
+			c.failed++
+		}
+	}
+	for _, r := range m.rows {
+		if !isTerminalStatus(r.Status) || !memMatch(r, days, repoSource, repoSlug) || (app != "" && r.NSAPP != app) {
+			continue
+		}
+		switch r.GPUPassthrough {
+		case "igpu", "dgpu", "vgpu":
+			add("gpu", [3]string{r.GPUPassthrough, r.GPUVendor, r.GPUModel}, r)
+		}
+		if r.CPUModel != "" || (r.CPUVendor != "" && r.CPUVendor != "unknown") {
+			add("cpu", [3]string{r.CPUVendor, r.CPUModel, ""}, r)
+		}
+		arm := "0"
+		if r.HasArm {
+			arm = "1"
+		}
+		add("arch", [3]string{r.NSAPP, arm, ""}, r)
+	}
+
+	flat := func(section string) []hwCount {
+		out := make([]hwCount, 0, len(counts[section]))
+		for _, c := range counts[section] {
+			out = append(out, *c)
+		}
+		return out
+	}
+	return buildHardwareData(days, flat("gpu"), flat("cpu"), flat("arch")), nil
+}
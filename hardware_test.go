@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+func TestCPUFamily(t *testing.T) {
+	tests := []struct {
+		vendor, model, want string
+	}{
+		{"intel", "Intel(R) Core(TM) i7-8700 CPU @ 3.20GHz", "Intel Core i7"},
+		{"intel", "Intel(R) Core(TM) Ultra 7 155H", "Intel Core Ultra"},
+		{"intel", "Intel(R) N100", "Intel N-series"},
+		{"intel", "Intel(R) Xeon(R) E-2236", "Intel Xeon"},
+		{"amd", "AMD Ryzen 5 5600G with Radeon Graphics", "AMD Ryzen 5"},
+		{"amd", "AMD EPYC 7302P 16-Core Processor", "AMD EPYC"},
+		{"arm", "Cortex-A72", "ARM Cortex-A72"},
+		{"amd", "something new", "AMD"},
+		{"unknown", "", ""},
+	}
+	for _, tt := range tests {
+		if got := cpuFamily(tt.vendor, tt.model); got != tt.want {
+			t.Errorf("cpuFamily(%q, %q) = %q, want %q", tt.vendor, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestGPUFamily(t *testing.T) {
+	tests := []struct {
+		vendor, model, want string
+	}{
+		{"intel", "Intel Arc A380", "Intel Arc"},
+		{"intel", "Intel UHD Graphics 630", "Intel UHD/HD"},
+		{"nvidia", "NVIDIA GeForce RTX 3060", "NVIDIA GeForce RTX"},
+		{"amd", "AMD Radeon RX 6600", "AMD Radeon (discrete)"},
+		{"amd", "AMD Radeon Vega 8", "AMD Radeon (integrated)"},
+		{"intel", "", "Intel"},
+	}
+	for _, tt := range tests {
+		if got := gpuFamily(tt.vendor, tt.model); got != tt.want {
+			t.Errorf("gpuFamily(%q, %q) = %q, want %q", tt.vendor, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestBuildHardwareData(t *testing.T) {
+	gpu := []hwCount{
+		{k1: "igpu", k2: "intel", k3: "Intel Arc A380", total: 20, success: 10, failed: 10},
+		{k1: "igpu", k2: "intel", k3: "Intel UHD Graphics 630", total: 100, success: 97, failed: 3},
+		{k1: "none", k2: "", total: 100, success: 95, failed: 5},
+	}
+	cpu := []hwCount{
+		{k1: "intel", k2: "Intel(R) N100", total: 10, success: 10},
+		{k1: "intel", k2: "Intel(R) N95", total: 5, success: 4, failed: 1},
+		{k1: "unknown", k2: "", total: 50, success: 50},
+	}
+	arch := []hwCount{
+		{k1: "jellyfin", k2: "1", total: 20, success: 8, failed: 12},
+		{k1: "jellyfin", k2: "0", total: 100, success: 95, failed: 5},
+		{k1: "x86only", k2: "0", total: 100, success: 100},
+	}
+	data := buildHardwareData(30, gpu, cpu, arch)
+
+	stats := func(list []HardwareStat) map[string]HardwareStat {
+		m := make(map[string]HardwareStat)
+		for _, s := range list {
+			m[s.Key] = s
+		}
+		return m
+	}
+	gpus := stats(data.GPU)
+	if len(gpus) != 2 || gpus["igpu / Intel"].Total != 120 || gpus["none / Unknown"].Total != 100 {
+		t.Errorf("gpu groups = %+v", data.GPU)
+	}
+	families := stats(data.GPUFamilies)
+	if !families["igpu / Intel Arc"].Flagged || families["igpu / Intel UHD/HD"].Flagged {
+		t.Errorf("gpu families = %+v, want only Intel Arc flagged", data.GPUFamilies)
+	}
+
+	// Unrecognized models without a vendor are left out.
+	cpus := stats(data.CPUFamilies)
+	if len(cpus) != 1 || cpus["Intel N-series"].Total != 15 || cpus["Intel N-series"].Failed != 1 {
+		t.Errorf("cpu families = %+v", data.CPUFamilies)
+	}
+
+	// Only apps with arm64 installs are compared.
+	if len(data.Arch) != 1 || data.Arch[0].App != "jellyfin" || !data.Arch[0].Flagged {
+		t.Fatalf("arch = %+v, want jellyfin flagged", data.Arch)
+	}
+	if a := data.Arch[0]; a.Arm.FailureRate != 60 || a.X86.FailureRate != 5 {
+		t.Errorf("arch failure rates = %.1f / %.1f, want 60 / 5", a.Arm.FailureRate, a.X86.FailureRate)
+	}
+}
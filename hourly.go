@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Hourly aggregation ----------
+// mv_daily_* cannot show intra-day spikes: a broken upstream download at 14:00
+// disappears in the day's total. mv_hourly_stats and mv_hourly_errors hold the
+// same counts per hour and expire after 7 days (TTL). Windows of up to
+// hourlyMaxDays (48 hours) are charted per hour, and the Alerter reads its
+// failure rate from the hourly buckets.
+
+const (
+	// hourlyMaxDays is the longest window (in days) charted per hour.
+	hourlyMaxDays = 2
+	// hourLayout is the bucket label of hourly series; the dashboards cut the
+	// year off like they do for dates.
+	hourLayout = "2006-01-02 15:00"
+)
+
+// HourlyStat holds the installs of one hour. Errors are real errors (failed,
+// not user-aborted, exit code != 0) like in mv_daily_errors.
+type HourlyStat struct {
+	Hour    time.Time `json:"hour"`
+	Total   int       `json:"total"`
+	Success int       `json:"success"`
+	Failed  int       `json:"failed"`
+	Aborted int       `json:"aborted"`
+	Errors  int       `json:"errors"`
+}
+
+// useHourly reports whether a window of days is charted per hour.
+func useHourly(days int) bool {
+	return days > 0 && days <= hourlyMaxDays
+}
+
+// statsInterval is the bucket size ("hour" or "day") of the series returned
+// for a window of days.
+func statsInterval(days int) string {
+	if useHourly(days) {
+		return "hour"
+	}
+	return "day"
+}
+
+// hourlyByLabel indexes stats by bucket label and returns the dense list of
+// labels from since up to the current hour.
+func hourlyByLabel(stats []HourlyStat, since time.Time) ([]string, map[string]HourlyStat) {
+	byLabel := make(map[string]HourlyStat, len(stats))
+	for _, s := range stats {
+		byLabel[s.Hour.UTC().Format(hourLayout)] = s
+	}
+	var labels []string
+	now := time.Now().UTC()
+	for h := since.UTC().Truncate(time.Hour); !h.After(now); h = h.Add(time.Hour) {
+		labels = append(labels, h.Format(hourLayout))
+	}
+	return labels, byLabel
+}
+
+// buildHourlyStats is the hourly counterpart of buildDailyStats.
+func buildHourlyStats(stats []HourlyStat, since time.Time) []DailyStat {
+	labels, byLabel := hourlyByLabel(stats, since)
+	result := make([]DailyStat, 0, len(labels))
+	for _, l := range labels {
+		result = append(result, DailyStat{Date: l, Success: byLabel[l].Success, Failed: byLabel[l].Failed})
+	}
+	return result
+}
+
+// buildHourlyTimeline is the hourly error timeline.
+func buildHourlyTimeline(stats []HourlyStat, since time.Time) []ErrorTimelinePoint {
+	labels, byLabel := hourlyByLabel(stats, since)
+	result := make([]ErrorTimelinePoint, 0, len(labels))
+	for _, l := range labels {
+		result = append(result, ErrorTimelinePoint{Date: l, Failed: byLabel[l].Errors})
+	}
+	return result
+}
+
+// sumHourly adds up success and failed of the buckets starting at since or
+// later.
+func sumHourly(stats []HourlyStat, since time.Time) (success, failed int) {
+	for _, s := range stats {
+		if !s.Hour.Before(since) {
+			success += s.Success
+			failed += s.Failed
+		}
+	}
+	return success, failed
+}
+
+// ══════════════════════════════════════════════════════════════
+//  HOURLY STATS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+// FetchHourlyStats returns the hours since the given time that have installs,
+// oldest first. Without a repo_slug filter it reads the hourly views, so since
+// must lie within their 7 day TTL.
+func (ch *CHClient) FetchHourlyStats(ctx context.Context, since time.Time, repoSource, repoSlug string) ([]HourlyStat, error) {
+	hours := make(map[int64]*HourlyStat)
+	get := func(h time.Time) *HourlyStat {
+		s, ok := hours[h.Unix()]
+		if !ok {
+			s = &HourlyStat{Hour: h.UTC()}
+			hours[h.Unix()] = s
+		}
+		return s
+	}
+
+	if repoSlug != "" {
+		w, args := chWhere(0, repoSource, repoSlug, "created >= ?")
+		args = append(args, since)
+		rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT toStartOfHour(created) h, count(), countIf(status='success'), countIf(status='failed'),
+				countIf(status='aborted'), countIf(status='failed' AND error_category!='user_aborted' AND exit_code!=0)
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY h`, w), args...)
+		if err != nil {
+			return nil, fmt.Errorf("CH hourly stats: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var h time.Time
+			var t, s, f, a, e uint64
+			if err := rows.Scan(&h, &t, &s, &f, &a, &e); err != nil {
+				log.Printf("[CH] hourly stats scan: %v", err)
+				continue
+			}
+			hs := get(h)
+			hs.Total, hs.Success, hs.Failed, hs.Aborted, hs.Errors = int(t), int(s), int(f), int(a), int(e)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return sortedHourly(hours), nil
+	}
+
+	parts := []string{"hour >= ?"}
+	args := []interface{}{since}
+	if pred, pArgs := repoSourcePred(repoSource); pred != "" {
+		parts = append(parts, pred)
+		args = append(args, pArgs...)
+	}
+	w := strings.Join(parts, " AND ")
+
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT hour, sum(total), sum(success), sum(failed), sum(aborted)
+		FROM telemetry_db.mv_hourly_stats WHERE %s
+		GROUP BY hour`, w), args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH hourly stats: %w", err)
+	}
+	for rows.Next() {
+		var h time.Time
+		var t, s, f, a uint64
+		if err := rows.Scan(&h, &t, &s, &f, &a); err != nil {
+			log.Printf("[CH] hourly stats scan: %v", err)
+			continue
+		}
+		hs := get(h)
+		hs.Total, hs.Success, hs.Failed, hs.Aborted = int(t), int(s), int(f), int(a)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT hour, sum(cnt)
+		FROM telemetry_db.mv_hourly_errors WHERE %s
+		GROUP BY hour`, w), args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH hourly errors: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h time.Time
+		var cnt uint64
+		if err := rows.Scan(&h, &cnt); err != nil {
+			log.Printf("[CH] hourly errors scan: %v", err)
+			continue
+		}
+		get(h).Errors = int(cnt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortedHourly(hours), nil
+}
+
+// sortedHourly returns the buckets oldest first.
+func sortedHourly(hours map[int64]*HourlyStat) []HourlyStat {
+	out := make([]HourlyStat, 0, len(hours))
+	for _, s := range hours {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hour.Before(out[j].Hour) })
+	return out
+}
+
+// ══════════════════════════════════════════════════════════════
+//  HOURLY STATS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchHourlyStats(ctx context.Context, since time.Time, repoSource, repoSlug string) ([]HourlyStat, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.hourlyStats(since, repoSource, repoSlug), nil
+}
+
+// hourlyStats aggregates the rows per hour; the caller holds m.mu.
+func (m *MemStore) hourlyStats(since time.Time, repoSource, repoSlug string) []HourlyStat {
+	hours := make(map[int64]*HourlyStat)
+	for _, r := range m.rows {
+		if r.Created.Before(since) || !memMatch(r, 0, repoSource, repoSlug) {
+			continue
+		}
+		h := r.Created.UTC().Truncate(time.Hour)
+		s, ok := hours[h.Unix()]
+		if !ok {
+			s = &HourlyStat{Hour: h}
+			hours[h.Unix()] = s
+		}
+		s.Total++
+		switch r.Status {
+		case "success":
+			s.Success++
+		case "failed":
+			s.Failed++
+		case "aborted":
+			s.Aborted++
+		}
+		if memRealError(r) {
+			s.Errors++
+		}
+	}
+	return sortedHourly(hours)
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ---------- Ingest pipeline ----------
+// The decode → sanitize → rescue → validate → reclassify → enqueue flow shared by
+// the single-event /telemetry endpoint and the /telemetry/batch endpoint.
+
+var (
+	errInvalidJSON    = errors.New("invalid json")
+	errInvalidPayload = errors.New("invalid payload")
+	errServerBusy     = errors.New("server busy")
+
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errBodyTooLarge        = errors.New("body too large")
+)
+
+// readBody reads a request body of at most limit bytes, transparently
+// decompressing Content-Encoding gzip and zstd. The limit applies both to the
+// bytes on the wire and to the decompressed size, so a small compressed body
+// cannot expand into an unbounded payload (decompression bomb).
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	body := io.Reader(http.MaxBytesReader(w, r.Body, limit))
+
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		body = zr
+	case "zstd":
+		zr, err := zstd.NewReader(body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(uint64(limit)))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnsupportedEncoding, enc)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, errBodyTooLarge
+		}
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return raw, nil
+}
+
+// bodyHTTPError maps a readBody error to the HTTP status and message returned
+// to the client.
+func bodyHTTPError(err error) (int, string) {
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType, "unsupported content encoding"
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge, "body too large"
+	}
+	return http.StatusBadRequest, "invalid body"
+}
+
+// ingestHTTPError maps an Ingest error to the HTTP status and short message
+// returned to the client. Details stay in the server log.
+func ingestHTTPError(err error) (int, string) {
+	switch {
+	case errors.Is(err, errServerBusy):
+		return http.StatusServiceUnavailable, "server busy"
+	case errors.Is(err, errInvalidJSON):
+		return http.StatusBadRequest, "invalid json"
+	case errors.Is(err, errInvalidPayload):
+		return http.StatusBadRequest, "invalid payload"
+	}
+	return http.StatusInternalServerError, "internal error"
+}
+
+// decodeTelemetry decodes a raw payload leniently: unknown fields are ignored for
+// forward compatibility. When api.func adds new fields before the server is
+// updated, requests must not be rejected — otherwise ALL telemetry is lost until
+// deploy. Broken bash-client JSON is retried through sanitizeRawJSON and, as a
+// last resort, rescueBrokenJSON. A dry run (/telemetry/validate) leaves the
+// metrics and the log untouched.
+func decodeTelemetry(raw []byte, dryRun bool) (TelemetryIn, error) {
+	var in TelemetryIn
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	err := dec.Decode(&in)
+	if err == nil {
+		if !dryRun {
+			metricDecode.Inc("clean")
+		}
+		return in, nil
+	}
+
+	// Attempt rescue: sanitize common bash-client JSON issues and retry
+	sanitized := sanitizeRawJSON(raw)
+	var in2 TelemetryIn
+	dec2 := json.NewDecoder(bytes.NewReader(sanitized))
+	if err2 := dec2.Decode(&in2); err2 == nil {
+		if !dryRun {
+			log.Printf("[WARN] json sanitized: nsapp=%s exec=%s (original error: %v)", in2.NSAPP, in2.ExecutionID, err)
+			metricDecode.Inc("sanitized")
+		}
+		return in2, nil
+	}
+
+	// Both sanitize attempts failed. Last resort: extract fields manually.
+	// This handles cases where the error field has unescaped quotes (mawk gsub issue).
+	in3, err3 := rescueBrokenJSON(raw)
+	if err3 != nil {
+		if !dryRun {
+			snippet := string(raw)
+			if len(snippet) > 2000 {
+				snippet = snippet[:2000] + "..."
+			}
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				log.Printf("[REJECT] json decode: %v (offset %d) | body=%s", err, syntaxErr.Offset, snippet)
+			} else {
+				log.Printf("[REJECT] json decode: %v | body=%s", err, snippet)
+			}
+			metricDecode.Inc("failed")
+		}
+		return in, fmt.Errorf("%w: %v", errInvalidJSON, err)
+	}
+	if !dryRun {
+		log.Printf("[WARN] json rescued: nsapp=%s exec=%s (original error: %v)", in3.NSAPP, in3.ExecutionID, err)
+		metricDecode.Inc("rescued")
+	}
+	return in3, nil
+}
+
+// normalizeTelemetry validates a decoded payload and applies the server-side
+// reclassification rules, returning the row that should be stored. A dry run
+// leaves the metrics and the log untouched.
+func normalizeTelemetry(in *TelemetryIn, logRequests, dryRun bool) (TelemetryOut, error) {
+	if err := validate(in, dryRun); err != nil {
+		if !dryRun {
+			log.Printf("[REJECT] validation: %v | nsapp=%s status=%s", err, in.NSAPP, in.Status)
+			for _, p := range fieldProblems(err) {
+				metricValidationReject.Inc(p.Field + ": " + p.Rule)
+			}
+		}
+		return TelemetryOut{NSAPP: in.NSAPP, ExecutionID: in.ExecutionID}, fmt.Errorf("%w: %w", errInvalidPayload, err)
+	}
+
+	// Auto-reclassify: exit_code=0 is NEVER an error — always reclassify as success
+	if in.Status == "failed" && in.ExitCode == 0 {
+		in.Status = "success"
+		in.Error = ""
+		in.ErrorCategory = ""
+		if !dryRun {
+			metricReclassified.Inc("exit_code_0")
+		}
+		if logRequests && !dryRun {
+			log.Printf("auto-reclassified exit_code=0 as success: nsapp=%s", in.NSAPP)
+		}
+	}
+
+	// Auto-reclassify: addon and pve type failures → success (excluded from failure stats)
+	if in.Status == "failed" && (in.Type == "addon" || in.Type == "pve") {
+		in.Status = "success"
+		in.Error = ""
+		in.ErrorCategory = ""
+		in.ExitCode = 0
+		if !dryRun {
+			metricReclassified.Inc("addon_pve")
+		}
+		if logRequests && !dryRun {
+			log.Printf("auto-reclassified %s failure as success: nsapp=%s", in.Type, in.NSAPP)
+		}
+	}
+
+	// Auto-reclassify: clients still send status="failed" for SIGINT/Ctrl+C and SIGHUP,
+	// detect and reclassify as "aborted" server-side.
+	if in.Status == "failed" && isAbortSignal(in.ExitCode, in.Error) {
+		in.Status = "aborted"
+		if in.ErrorCategory == "" || in.ErrorCategory == "unknown" {
+			in.ErrorCategory = "user_aborted"
+		}
+		if !dryRun {
+			metricReclassified.Inc("abort_signal")
+		}
+		if logRequests && !dryRun {
+			log.Printf("auto-reclassified as aborted: nsapp=%s exit_code=%d", in.NSAPP, in.ExitCode)
+		}
+	}
+
+	// Authoritative error categorization: the server is the single source of
+	// truth. When the server can confidently derive a category (from exit code
+	// or error text), it overrides whatever the client sent so that client/server
+	// mappings can never diverge. Only when the server is unsure do we keep the
+	// client's category (it may have had extra local context).
+	if in.Status == "failed" {
+		if serverCat := deriveErrorCategory(in.ExitCode, in.Error); serverCat != "unknown" && serverCat != "" {
+			in.ErrorCategory = serverCat
+		} else if in.ErrorCategory == "" {
+			in.ErrorCategory = "unknown"
+		}
+	}
+
+	// Enrich error text with exit code description if error text is empty
+	if in.Status == "failed" && in.Error == "" && in.ExitCode != 0 {
+		in.Error = fmt.Sprintf("Exit code %d: %s", in.ExitCode, getExitCodeDescription(in.ExitCode))
+	}
+
+	var fingerprint string
+	if in.Status == "failed" {
+		fingerprint = errorFingerprint(in.Error)
+	}
+
+	// Map input to telemetry schema
+	return TelemetryOut{
+		RandomID:         in.RandomID,
+		ExecutionID:      in.ExecutionID,
+		Type:             in.Type,
+		NSAPP:            in.NSAPP,
+		Status:           in.Status,
+		CTType:           in.CTType,
+		DiskSize:         in.DiskSize,
+		CoreCount:        in.CoreCount,
+		RAMSize:          in.RAMSize,
+		OsType:           in.OsType,
+		OsVersion:        in.OsVersion,
+		PveVer:           in.PveVer,
+		Method:           in.Method,
+		Error:            in.Error,
+		ExitCode:         in.ExitCode,
+		GPUVendor:        in.GPUVendor,
+		GPUModel:         in.GPUModel,
+		GPUPassthrough:   in.GPUPassthrough,
+		CPUVendor:        in.CPUVendor,
+		CPUModel:         in.CPUModel,
+		RAMSpeed:         in.RAMSpeed,
+		InstallDuration:  in.InstallDuration,
+		ErrorCategory:    in.ErrorCategory,
+		RepoSource:       in.RepoSource,
+		RepoSlug:         in.RepoSlug,
+		HasArm:           in.HasArm,
+		ScriptVersion:    in.ScriptVersion,
+		ScriptCommit:     in.ScriptCommit,
+		ErrorFingerprint: fingerprint,
+	}, nil
+}
+
+// Ingestor runs raw telemetry payloads through the full pipeline and hands the
+// normalized rows to the write queue.
+type Ingestor struct {
+	queue       *WriteQueue
+	dead        *DeadLetterStore
+	logRequests bool
+}
+
+// NewIngestor creates an ingestor that enqueues accepted payloads on queue and
+// records rejected ones in dead (may be nil).
+func NewIngestor(queue *WriteQueue, dead *DeadLetterStore, logRequests bool) *Ingestor {
+	return &Ingestor{
+		queue:       queue,
+		dead:        dead,
+		logRequests: logRequests,
+	}
+}
+
+// Ingest decodes, validates, reclassifies and enqueues one raw payload. The
+// returned error wraps errInvalidJSON, errInvalidPayload or errServerBusy.
+// Decode and validation rejects are kept as dead letters.
+func (ing *Ingestor) Ingest(raw []byte) (TelemetryOut, error) {
+	out, err := ing.process(raw)
+	switch {
+	case errors.Is(err, errInvalidJSON):
+		ing.dead.Record(deadLetterStageDecode, err.Error(), raw, "", "")
+	case errors.Is(err, errInvalidPayload):
+		ing.dead.Record(deadLetterStageValidate, err.Error(), raw, out.NSAPP, out.ExecutionID)
+	}
+	return out, err
+}
+
+// process is Ingest without dead-letter recording (also used by Replay).
+func (ing *Ingestor) process(raw []byte) (TelemetryOut, error) {
+	in, err := decodeTelemetry(raw, false)
+	if err != nil {
+		return TelemetryOut{}, err
+	}
+	out, err := normalizeTelemetry(&in, ing.logRequests, false)
+	if err != nil {
+		return out, err
+	}
+
+	// Enqueue for async ClickHouse write (decoupled from HTTP response)
+	if !ing.queue.Enqueue(out) {
+		log.Printf("[QUEUE] full, dropping nsapp=%s status=%s exec=%s", out.NSAPP, out.Status, out.ExecutionID)
+		metricQueueDropped.Inc("enqueue")
+		return out, errServerBusy
+	}
+
+	if ing.logRequests {
+		log.Printf("telemetry accepted nsapp=%s status=%s repo=%s qlen=%d", out.NSAPP, out.Status, out.RepoSource, ing.queue.Len())
+	}
+	return out, nil
+}
+
+// ---------- Batch ingest ----------
+
+// BatchItemResult is the per-item outcome returned by /telemetry/batch.
+type BatchItemResult struct {
+	Index       int            `json:"index"`
+	Status      string         `json:"status"` // "accepted" or "rejected"
+	ExecutionID string         `json:"execution_id,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Problems    []FieldProblem `json:"problems,omitempty"`
+}
+
+// BatchResponse is the body returned by /telemetry/batch.
+type BatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+// splitBatch splits a batch body into individual raw payloads. A body starting
+// with '[' is treated as a JSON array of objects; anything else as NDJSON (one
+// object per line, blank lines ignored). Array elements and NDJSON lines are
+// kept as raw bytes so a single broken item still gets the sanitize/rescue
+// treatment.
+func splitBatch(raw []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return nil, errors.New("empty batch")
+	}
+	if trimmed[0] == '[' {
+		return splitJSONArray(trimmed)
+	}
+
+	var out [][]byte
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, nil
+}
+
+// splitJSONArray splits a JSON array into its raw elements, decoding them one at
+// a time. An element that does not decode is cut at its closing brace and kept
+// as is, so a broken element does not fail the whole batch.
+func splitJSONArray(raw []byte) ([][]byte, error) {
+	out := [][]byte{}
+	rest := bytes.TrimSpace(raw[1:])
+	if len(rest) > 0 && rest[0] == ']' {
+		rest = rest[1:]
+	} else {
+		for {
+			var item json.RawMessage
+			dec := json.NewDecoder(bytes.NewReader(rest))
+			if err := dec.Decode(&item); err == nil {
+				out = append(out, item)
+				rest = rest[dec.InputOffset():]
+			} else if n := brokenElementLen(rest); n > 0 {
+				out = append(out, rest[:n])
+				rest = rest[n:]
+			} else {
+				return nil, fmt.Errorf("json array element %d: %w", len(out), err)
+			}
+
+			rest = bytes.TrimSpace(rest)
+			if len(rest) == 0 {
+				return nil, errors.New("json array: unexpected end")
+			}
+			if rest[0] == ']' {
+				rest = rest[1:]
+				break
+			}
+			if rest[0] != ',' {
+				return nil, fmt.Errorf("json array element %d: expected ',' or ']'", len(out))
+			}
+			rest = bytes.TrimSpace(rest[1:])
+		}
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, errors.New("json array: trailing data")
+	}
+	return out, nil
+}
+
+// brokenElementLen returns the length of the object at the start of b by
+// matching braces outside of strings, without validating anything else (raw
+// control characters inside strings are the usual breakage). Unescaped quotes
+// throw the string tracking off; then the object ends at the first '}' that is
+// followed by the next object or the end of the array. It returns 0 when b
+// does not start with an object or no end is found.
+func brokenElementLen(b []byte) int {
+	if len(b) == 0 || b[0] != '{' {
+		return 0
+	}
+	depth := 0
+	inString, escaped := false, false
+	for i, c := range b {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	for i, c := range b {
+		if c != '}' {
+			continue
+		}
+		next := bytes.TrimSpace(b[i+1:])
+		if (len(next) == 1 && next[0] == ']') ||
+			(len(next) > 0 && next[0] == ',' && bytes.HasPrefix(bytes.TrimSpace(next[1:]), []byte("{"))) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// IngestBatch runs every item through Ingest and collects the per-item results.
+// Items are enqueued in order, so an "installing" event sent before its
+// terminal event in the same batch is also queued first.
+func (ing *Ingestor) IngestBatch(items [][]byte) BatchResponse {
+	resp := BatchResponse{Results: make([]BatchItemResult, 0, len(items))}
+	for i, raw := range items {
+		out, err := ing.Ingest(raw)
+		res := BatchItemResult{Index: i, ExecutionID: out.ExecutionID}
+		if err != nil {
+			res.Status = "rejected"
+			res.Error = err.Error()
+			res.Problems = fieldProblems(err)
+			resp.Rejected++
+		} else {
+			res.Status = "accepted"
+			resp.Accepted++
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	return resp
+}
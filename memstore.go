@@ -0,0 +1,1049 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- In-memory store ----------
+// MemStore keeps raw telemetry rows in memory and computes every API response
+// from them with the same filters as the ClickHouse queries (the materialized
+// views only pre-aggregate the raw table, so the results match). It is meant
+// for local development and tests: nothing is persisted and memory grows with
+// the number of events.
+
+type memRow struct {
+	TelemetryOut
+	ID      string
+	Created time.Time
+}
+
+type memDeadLetter struct {
+	DeadLetter
+	created time.Time
+}
+
+// MemStore is the in-memory Store implementation (STORE_BACKEND=memory).
+type MemStore struct {
+	mu   sync.RWMutex
+	rows []memRow
+	dead []memDeadLetter
+}
+
+// NewMemStore creates an empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{}
+}
+
+func (m *MemStore) Ping(ctx context.Context) error { return nil }
+func (m *MemStore) Close() error                   { return nil }
+
+// ══════════════════════════════════════════════════════════════
+//  HELPERS
+// ══════════════════════════════════════════════════════════════
+
+// memCreatedString formats a timestamp like ClickHouse's toString(DateTime64(3)).
+func memCreatedString(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.000")
+}
+
+func memDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// memRepoMatch mirrors repoSourcePred.
+func memRepoMatch(r memRow, repoSource string) bool {
+	switch repoSource {
+	case "":
+		return true
+	case "ProxmoxVE":
+		return r.RepoSource == "ProxmoxVE" || r.RepoSource == ""
+	default:
+		return r.RepoSource == repoSource
+	}
+}
+
+// memMatch mirrors chWhere (without extra predicates).
+func memMatch(r memRow, days int, repoSource, repoSlug string) bool {
+	if days > 0 && r.Created.Before(chSinceTime(days)) {
+		return false
+	}
+	if !memRepoMatch(r, repoSource) {
+		return false
+	}
+	return repoSlug == "" || r.RepoSlug == repoSlug
+}
+
+func memInProgress(status string) bool {
+	return status == "installing" || status == "validation" || status == "configuring"
+}
+
+// memRealError matches failed rows counted as real errors (mv_daily_errors).
+func memRealError(r memRow) bool {
+	return r.Status == "failed" && r.ErrorCategory != "user_aborted" && r.ExitCode != 0
+}
+
+// memAbortLike mirrors the abort detection in latestStatusSQL.
+func memAbortLike(r memRow) bool {
+	if r.ExitCode == 129 || r.ExitCode == 130 {
+		return true
+	}
+	e := strings.ToLower(r.Error)
+	return containsAny(e, "sigint", "sighup", "ctrl+c", "ctrl-c")
+}
+
+type memCount struct {
+	Key   string
+	Count int
+}
+
+// memTop sorts counts descending (ties by key) and keeps at most limit entries.
+func memTop(counts map[string]int, limit int) []memCount {
+	out := make([]memCount, 0, len(counts))
+	for k, c := range counts {
+		out = append(out, memCount{k, c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// memUniqueList collects up to n distinct values in first-seen order.
+type memUniqueList struct {
+	seen map[string]bool
+	list []string
+}
+
+func (u *memUniqueList) add(v string) {
+	if u.seen == nil {
+		u.seen = make(map[string]bool)
+	}
+	if !u.seen[v] {
+		u.seen[v] = true
+		u.list = append(u.list, v)
+	}
+}
+
+func (u *memUniqueList) first(n int) string {
+	if len(u.list) > n {
+		return strings.Join(u.list[:n], ", ")
+	}
+	return strings.Join(u.list, ", ")
+}
+
+// terminalIDs returns the execution_ids that already have a terminal row.
+func (m *MemStore) terminalIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, r := range m.rows {
+		if r.ExecutionID != "" && isTerminalStatus(r.Status) {
+			ids[r.ExecutionID] = true
+		}
+	}
+	return ids
+}
+
+// stuckCount counts in-progress rows of today without a terminal row.
+func (m *MemStore) stuckCount(repoSource, repoSlug string, terminal map[string]bool) int {
+	n := 0
+	for _, r := range m.rows {
+		if memMatch(r, 1, repoSource, repoSlug) && memInProgress(r.Status) &&
+			(r.ExecutionID == "" || !terminal[r.ExecutionID]) {
+			n++
+		}
+	}
+	return n
+}
+
+// memErrorPattern mirrors the multiIf() grouping of the dashboard error analysis.
+func memErrorPattern(errText string) string {
+	e := strings.ToLower(errText)
+	switch {
+	case strings.Contains(e, "connection refused"):
+		return "connection refused"
+	case strings.Contains(e, "timeout"):
+		return "timeout"
+	case strings.Contains(e, "no space left"):
+		return "disk full"
+	case strings.Contains(e, "permission denied"):
+		return "permission denied"
+	case strings.Contains(e, "not found"):
+		return "not found"
+	case strings.Contains(e, "apt"):
+		return "apt error"
+	case strings.Contains(e, "dpkg"):
+		return "dpkg error"
+	case strings.Contains(e, "curl"), strings.Contains(e, "wget"):
+		return "network error"
+	case strings.Contains(e, "docker"):
+		return "docker error"
+	case strings.Contains(e, "systemctl"):
+		return "systemd error"
+	}
+	if len(e) > 40 {
+		return e[:40]
+	}
+	return e
+}
+
+// ══════════════════════════════════════════════════════════════
+//  WRITE OPERATIONS
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) InsertTelemetry(ctx context.Context, p TelemetryOut) error {
+	return m.InsertTelemetryBatch(ctx, []TelemetryOut{p})
+}
+
+func (m *MemStore) InsertTelemetryBatch(ctx context.Context, rows []TelemetryOut) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range rows {
+		p.Pipeline = ""
+		m.rows = append(m.rows, memRow{TelemetryOut: p, ID: generateRecordID(), Created: time.Now().UTC()})
+	}
+	return nil
+}
+
+func (m *MemStore) HasTerminalExecutionIDs(ctx context.Context, eids []string) (map[string]bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	want := make(map[string]bool, len(eids))
+	for _, id := range eids {
+		want[id] = true
+	}
+	found := make(map[string]bool)
+	for _, r := range m.rows {
+		if want[r.ExecutionID] && isTerminalStatus(r.Status) {
+			found[r.ExecutionID] = true
+		}
+	}
+	return found, nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  DASHBOARD DATA
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchRepoSlugs(ctx context.Context, days int, repoSource string) ([]RepoSlugCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := make(map[string]int)
+	for _, r := range m.rows {
+		if r.RepoSlug != "" && memMatch(r, days, repoSource, "") {
+			counts[r.RepoSlug]++
+		}
+	}
+	var out []RepoSlugCount
+	for _, c := range memTop(counts, 50) {
+		out = append(out, RepoSlugCount{Slug: c.Key, Count: c.Count})
+	}
+	return out, nil
+}
+
+func (m *MemStore) FetchDashboardData(ctx context.Context, days int, repoSource, repoSlug string) (*DashboardData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data := &DashboardData{}
+	apps := make(map[string]int)
+	oses := make(map[string]int)
+	methods := make(map[string]int)
+	pves := make(map[string]int)
+	types := make(map[string]int)
+	tools := make(map[string]int)
+	addons := make(map[string]int)
+	slugs := make(map[string]int)
+	gpus := make(map[string]int)
+	cats := make(map[string]int)
+	errCounts := make(map[string]int)
+	errApps := make(map[string]*memUniqueList)
+	appTotal := make(map[string]int)
+	appFailed := make(map[string]int)
+	appType := make(map[string]string)
+	sMap := make(map[string]int)
+	fMap := make(map[string]int)
+	var durSum, durCnt int
+
+	for _, r := range m.rows {
+		if !memMatch(r, days, repoSource, repoSlug) {
+			continue
+		}
+		terminal := isTerminalStatus(r.Status)
+
+		data.TotalInstalls++
+		switch r.Status {
+		case "success":
+			data.SuccessCount++
+			sMap[memDay(r.Created)]++
+		case "failed":
+			data.FailedCount++
+			fMap[memDay(r.Created)]++
+		case "aborted":
+			data.AbortedCount++
+		}
+		if terminal && r.InstallDuration > 0 {
+			durSum += r.InstallDuration
+			durCnt++
+		}
+		if r.NSAPP != "" {
+			apps[r.NSAPP]++
+			appTotal[r.NSAPP]++
+			appType[r.NSAPP] = r.Type
+			if r.Status == "failed" {
+				appFailed[r.NSAPP]++
+			}
+			switch r.Type {
+			case "pve":
+				tools[r.NSAPP]++
+			case "addon":
+				addons[r.NSAPP]++
+			}
+		}
+		if r.Type != "" {
+			types[r.Type]++
+		}
+		if terminal {
+			if r.OsType != "" {
+				oses[r.OsType]++
+			}
+			if r.Method != "" {
+				methods[r.Method]++
+			}
+			if r.PveVer != "" {
+				pves[r.PveVer]++
+			}
+			if r.GPUVendor != "" && r.GPUVendor != "unknown" {
+				gpus[r.GPUVendor+"|"+r.GPUPassthrough]++
+			}
+		}
+		if r.Status == "failed" && r.ErrorCategory != "user_aborted" {
+			if r.ErrorCategory != "" {
+				cats[r.ErrorCategory]++
+			}
+			if r.Error != "" {
+				pat := memErrorPattern(r.Error)
+				errCounts[pat]++
+				if errApps[pat] == nil {
+					errApps[pat] = &memUniqueList{}
+				}
+				errApps[pat].add(r.NSAPP)
+			}
+		}
+		if repoSlug == "" && r.RepoSlug != "" {
+			slugs[r.RepoSlug]++
+		}
+	}
+
+	// ── 1. Main counts ──
+	if data.SuccessCount+data.FailedCount > 0 {
+		data.SuccessRate = float64(data.SuccessCount) / float64(data.SuccessCount+data.FailedCount) * 100
+	}
+	if durCnt > 0 {
+		data.AvgInstallDuration = float64(durSum) / float64(durCnt)
+	}
+	data.TotalAllTime = len(m.rows)
+	data.SampleSize = data.TotalInstalls
+
+	// ── 2. Installing count ──
+	data.InstallingCount = m.stuckCount(repoSource, repoSlug, m.terminalIDs())
+
+	// ── 3-7. Distributions ──
+	for _, c := range memTop(apps, 20) {
+		data.TopApps = append(data.TopApps, AppCount{App: c.Key, Count: c.Count})
+	}
+	for _, c := range memTop(oses, 15) {
+		data.OsDistribution = append(data.OsDistribution, OsCount{Os: c.Key, Count: c.Count})
+	}
+	for _, c := range memTop(methods, 10) {
+		data.MethodStats = append(data.MethodStats, MethodCount{Method: c.Key, Count: c.Count})
+	}
+	for _, c := range memTop(pves, 15) {
+		data.PveVersions = append(data.PveVersions, PveCount{Version: c.Key, Count: c.Count})
+	}
+	for _, c := range memTop(types, 10) {
+		data.TypeStats = append(data.TypeStats, TypeCount{Type: c.Key, Count: c.Count})
+	}
+
+	// ── 8. Error analysis ──
+	for _, c := range memTop(errCounts, 15) {
+		data.ErrorAnalysis = append(data.ErrorAnalysis, ErrorGroup{
+			Pattern:    c.Key,
+			Count:      c.Count,
+			UniqueApps: len(errApps[c.Key].list),
+			Apps:       errApps[c.Key].first(5),
+		})
+	}
+
+	// ── 9. Failed apps with failure rates ──
+	minInstalls := 10
+	switch {
+	case days <= 1:
+		minInstalls = 5
+	case days <= 7:
+		minInstalls = 15
+	case days <= 30:
+		minInstalls = 40
+	default:
+		minInstalls = 100
+	}
+	type appRate struct {
+		app  string
+		rate float64
+	}
+	var candidates []appRate
+	for app, f := range appFailed {
+		if t := appTotal[app]; t >= minInstalls {
+			candidates = append(candidates, appRate{app, float64(f) / float64(t)})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].rate > candidates[j].rate })
+	if len(candidates) > 50 {
+		candidates = candidates[:50]
+	}
+	failTotal := make(map[string]int)
+	failCount := make(map[string]int)
+	for _, c := range candidates {
+		key := c.app + "|" + appType[c.app]
+		failTotal[key] = appTotal[c.app]
+		failCount[key] = appFailed[c.app]
+	}
+	data.FailedApps = buildFailedApps(failTotal, failCount, 16, minInstalls)
+
+	// ── 10. Daily stats (per hour for windows of up to 48 hours) ──
+	data.Interval = statsInterval(days)
+	if useHourly(days) {
+		since := chSinceTime(days)
+		data.DailyStats = buildHourlyStats(m.hourlyStats(since, repoSource, repoSlug), since)
+	} else {
+		actualDays := days
+		if actualDays <= 0 {
+			actualDays = 365
+		}
+		data.DailyStats = buildDailyStats(sMap, fMap, actualDays)
+	}
+
+	// ── 11-14. GPU, error categories, tools, addons ──
+	for _, c := range memTop(gpus, 0) {
+		parts := strings.SplitN(c.Key, "|", 2)
+		data.GPUStats = append(data.GPUStats, GPUCount{Vendor: parts[0], Passthrough: parts[1], Count: c.Count})
+	}
+	for _, c := range memTop(cats, 0) {
+		data.ErrorCategories = append(data.ErrorCategories, ErrorCatCount{Category: c.Key, Count: c.Count})
+	}
+	for _, c := range memTop(tools, 15) {
+		data.TopTools = append(data.TopTools, ToolCount{Tool: c.Key, Count: c.Count})
+		data.TotalTools += c.Count
+	}
+	for _, c := range memTop(addons, 15) {
+		data.TopAddons = append(data.TopAddons, AddonCount{Addon: c.Key, Count: c.Count})
+		data.TotalAddons += c.Count
+	}
+
+	// ── 15. Recent records ──
+	data.RecentRecords, _ = m.records(1, 20, "", "", "", "", "-created", repoSource, repoSlug, days)
+
+	// ── 16. Repository slug breakdown ──
+	for _, c := range memTop(slugs, 20) {
+		data.RepoSlugs = append(data.RepoSlugs, RepoSlugCount{Slug: c.Key, Count: c.Count})
+	}
+
+	return data, nil
+}
+
+func (m *MemStore) FetchScriptStats(ctx context.Context, days int, repoSource string, knownScripts map[string]ScriptInfo) (*ScriptAnalysisData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byApp := make(map[string]*scriptAgg)
+	for _, r := range m.rows {
+		if !memMatch(r, days, repoSource, "") {
+			continue
+		}
+		a := byApp[r.NSAPP]
+		if a == nil {
+			a = &scriptAgg{App: r.NSAPP}
+			byApp[r.NSAPP] = a
+		}
+		a.Type = r.Type
+		a.Total++
+		switch r.Status {
+		case "success":
+			a.Success++
+		case "failed":
+			a.Failed++
+		case "aborted":
+			a.Aborted++
+		}
+	}
+	aggs := make([]scriptAgg, 0, len(byApp))
+	for _, a := range byApp {
+		aggs = append(aggs, *a)
+	}
+	sort.Slice(aggs, func(i, j int) bool { return aggs[i].Total > aggs[j].Total })
+	return buildScriptStats(aggs, days, knownScripts), nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  ERROR ANALYSIS
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchErrorAnalysisData(ctx context.Context, days int, repoSource, repoSlug string) (*ErrorAnalysisData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data := &ErrorAnalysisData{}
+	exitCodes := make(map[int]int)
+	cats := make(map[string]int)
+	catApps := make(map[string]*memUniqueList)
+	dailyF := make(map[string]int)
+
+	type appAgg struct {
+		typ, topErr, topCat string
+		total, failed, ab   int
+		exitCodes           map[int]int
+	}
+	apps := make(map[string]*appAgg)
+	var recent []memRow
+
+	for _, r := range m.rows {
+		if !memMatch(r, days, repoSource, repoSlug) {
+			continue
+		}
+		data.TotalInstalls++
+		realFailure := r.Status == "failed" && r.ErrorCategory != "user_aborted"
+		if memRealError(r) {
+			data.TotalErrors++
+			exitCodes[r.ExitCode]++
+			dailyF[memDay(r.Created)]++
+		}
+		if realFailure {
+			recent = append(recent, r)
+			if r.ErrorCategory != "" {
+				cats[r.ErrorCategory]++
+				if catApps[r.ErrorCategory] == nil {
+					catApps[r.ErrorCategory] = &memUniqueList{}
+				}
+				catApps[r.ErrorCategory].add(r.NSAPP)
+			}
+		}
+
+		if r.NSAPP == "" || !isTerminalStatus(r.Status) {
+			continue
+		}
+		a := apps[r.NSAPP]
+		if a == nil {
+			a = &appAgg{exitCodes: make(map[int]int)}
+			apps[r.NSAPP] = a
+		}
+		a.typ = r.Type
+		a.total++
+		if realFailure {
+			a.failed++
+			if r.ExitCode != 0 {
+				a.exitCodes[r.ExitCode]++
+			}
+			if a.topErr == "" && r.Error != "" {
+				a.topErr = r.Error
+			}
+			if a.topCat == "" && r.ErrorCategory != "" && r.ErrorCategory != "uncategorized" {
+				a.topCat = r.ErrorCategory
+			}
+		}
+		if r.Status == "aborted" && r.ErrorCategory != "user_aborted" {
+			a.ab++
+		}
+	}
+
+	if data.TotalInstalls > 0 {
+		data.OverallFailRate = float64(data.TotalErrors) / float64(data.TotalInstalls) * 100
+	}
+	data.StuckInstalling = m.stuckCount(repoSource, repoSlug, m.terminalIDs())
+
+	// Exit code stats
+	codes := make(map[string]int, len(exitCodes))
+	for code, cnt := range exitCodes {
+		codes[fmt.Sprint(code)] = cnt
+	}
+	for _, c := range memTop(codes, 30) {
+		var code int
+		fmt.Sscanf(c.Key, "%d", &code)
+		pct := float64(0)
+		if data.TotalErrors > 0 {
+			pct = float64(c.Count) / float64(data.TotalErrors) * 100
+		}
+		data.ExitCodeStats = append(data.ExitCodeStats, ExitCodeStat{
+			ExitCode: code, Count: c.Count, Percentage: pct,
+			Description: getExitCodeDescription(code),
+			Category:    getExitCodeCategory(code),
+		})
+	}
+
+	// Category stats
+	for _, c := range memTop(cats, 0) {
+		cs := CategoryStat{Category: c.Key, Count: c.Count, TopApps: catApps[c.Key].first(5)}
+		if data.TotalErrors > 0 {
+			cs.Percentage = float64(c.Count) / float64(data.TotalErrors) * 100
+		}
+		data.CategoryStats = append(data.CategoryStats, cs)
+	}
+
+	// App errors
+	for app, a := range apps {
+		if a.failed+a.ab == 0 {
+			continue
+		}
+		ae := AppErrorDetail{
+			App: app, Type: a.typ,
+			TotalCount: a.total, FailedCount: a.failed, AbortedCount: a.ab,
+			TopError: a.topErr, TopCategory: a.topCat,
+		}
+		if a.total > 0 {
+			ae.FailureRate = float64(a.failed) / float64(a.total) * 100
+		}
+		best := 0
+		for code, cnt := range a.exitCodes {
+			if cnt > best || (cnt == best && code < ae.TopExitCode) {
+				best, ae.TopExitCode = cnt, code
+			}
+		}
+		data.AppErrors = append(data.AppErrors, ae)
+	}
+	sort.Slice(data.AppErrors, func(i, j int) bool {
+		if data.AppErrors[i].FailedCount != data.AppErrors[j].FailedCount {
+			return data.AppErrors[i].FailedCount > data.AppErrors[j].FailedCount
+		}
+		return data.AppErrors[i].App < data.AppErrors[j].App
+	})
+	if len(data.AppErrors) > 50 {
+		data.AppErrors = data.AppErrors[:50]
+	}
+
+	// Error timeline (per hour for windows of up to 48 hours)
+	data.Interval = statsInterval(days)
+	if useHourly(days) {
+		since := chSinceTime(days)
+		data.ErrorTimeline = buildHourlyTimeline(m.hourlyStats(since, repoSource, repoSlug), since)
+	} else {
+		actualDays := days
+		if actualDays <= 0 {
+			actualDays = 30
+		}
+		for i := actualDays - 1; i >= 0; i-- {
+			date := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
+			data.ErrorTimeline = append(data.ErrorTimeline, ErrorTimelinePoint{
+				Date:   date,
+				Failed: dailyF[date],
+			})
+		}
+	}
+
+	// Recent errors
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].Created.After(recent[j].Created) })
+	if len(recent) > 100 {
+		recent = recent[:100]
+	}
+	for _, r := range recent {
+		data.RecentErrors = append(data.RecentErrors, ErrorRecord{
+			NSAPP: r.NSAPP, Type: r.Type, Status: r.Status, ExitCode: r.ExitCode,
+			Error: r.Error, ErrorCategory: r.ErrorCategory,
+			OsType: r.OsType, OsVersion: r.OsVersion, Created: memCreatedString(r.Created),
+		})
+	}
+
+	return data, nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  PAGINATED RECORDS
+// ══════════════════════════════════════════════════════════════
+
+// memStatusRank mirrors statusRankSQL.
+func memStatusRank(status string) int {
+	switch {
+	case isTerminalStatus(status):
+		return 0
+	case status == "configuring":
+		return 1
+	case status == "validation":
+		return 2
+	case status == "installing":
+		return 3
+	}
+	return 4
+}
+
+// memBetterRow reports whether a should represent its installation instead of
+// b (statusRankOrderSQL).
+func memBetterRow(a, b memRow) bool {
+	ra, rb := memStatusRank(a.Status), memStatusRank(b.Status)
+	if ra != rb {
+		return ra < rb
+	}
+	if ra == 0 {
+		sa, sb := len(a.Error)+a.DiskSize, len(b.Error)+b.DiskSize
+		if sa != sb {
+			return sa > sb
+		}
+	}
+	return a.Created.After(b.Created)
+}
+
+func memLatestStatusMatch(r memRow, status string) bool {
+	switch status {
+	case "":
+		return true
+	case "aborted":
+		return r.Status == "aborted" || (r.Status == "failed" && memAbortLike(r))
+	case "failed":
+		return r.Status == "failed" && !memAbortLike(r)
+	default:
+		return r.Status == status
+	}
+}
+
+func (m *MemStore) FetchRecordsPaginated(ctx context.Context, page, limit int,
+	status, app, osType, typeFilter, sortField, repoSource, repoSlug string, days int,
+) ([]TelemetryRecord, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	records, total := m.records(page, limit, status, app, osType, typeFilter, sortField, repoSource, repoSlug, days)
+	return records, total, nil
+}
+
+// records implements FetchRecordsPaginated. Caller holds mu.
+func (m *MemStore) records(page, limit int,
+	status, app, osType, typeFilter, sortField, repoSource, repoSlug string, days int,
+) ([]TelemetryRecord, int) {
+	appLower := strings.ToLower(app)
+	best := make(map[string]memRow)
+	for _, r := range m.rows {
+		if !memMatch(r, days, repoSource, repoSlug) ||
+			(app != "" && !strings.Contains(strings.ToLower(r.NSAPP), appLower)) ||
+			(osType != "" && r.OsType != osType) ||
+			(typeFilter != "" && r.Type != typeFilter) {
+			continue
+		}
+		key := r.ExecutionID
+		if key == "" {
+			key = r.RandomID
+		}
+		if cur, ok := best[key]; !ok || memBetterRow(r, cur) {
+			best[key] = r
+		}
+	}
+
+	list := make([]memRow, 0, len(best))
+	for _, r := range best {
+		if memLatestStatusMatch(r, status) {
+			list = append(list, r)
+		}
+	}
+
+	field, desc := strings.TrimPrefix(sortField, "-"), strings.HasPrefix(sortField, "-")
+	less := func(a, b memRow) bool { return a.Created.Before(b.Created) }
+	switch field {
+	case "nsapp":
+		less = func(a, b memRow) bool { return a.NSAPP < b.NSAPP }
+	case "status":
+		less = func(a, b memRow) bool { return a.Status < b.Status }
+	case "os_type":
+		less = func(a, b memRow) bool { return a.OsType < b.OsType }
+	case "type":
+		less = func(a, b memRow) bool { return a.Type < b.Type }
+	case "method":
+		less = func(a, b memRow) bool { return a.Method < b.Method }
+	case "exit_code":
+		less = func(a, b memRow) bool { return a.ExitCode < b.ExitCode }
+	case "created":
+	default:
+		desc = true // default: created DESC
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if desc {
+			return less(list[j], list[i])
+		}
+		return less(list[i], list[j])
+	})
+
+	total := len(list)
+	offset := (page - 1) * limit
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	records := make([]TelemetryRecord, 0, end-offset)
+	for _, r := range list[offset:end] {
+		records = append(records, TelemetryRecord{TelemetryOut: r.TelemetryOut, Created: memCreatedString(r.Created)})
+	}
+	m.attachPipelines(records)
+	return records, total
+}
+
+// attachPipelines mirrors CHClient.attachPipelines. Caller holds mu.
+func (m *MemStore) attachPipelines(records []TelemetryRecord) {
+	want := make(map[string]bool)
+	for _, r := range records {
+		if r.ExecutionID != "" {
+			want[r.ExecutionID] = true
+		}
+	}
+	if len(want) == 0 {
+		return
+	}
+
+	steps := make(map[string][]memRow)
+	for _, r := range m.rows {
+		if want[r.ExecutionID] && (memInProgress(r.Status) || isTerminalStatus(r.Status)) {
+			steps[r.ExecutionID] = append(steps[r.ExecutionID], r)
+		}
+	}
+	for i := range records {
+		rows := steps[records[i].ExecutionID]
+		if len(rows) == 0 {
+			continue
+		}
+		sort.SliceStable(rows, func(a, b int) bool { return rows[a].Created.Before(rows[b].Created) })
+		var out []pipelineStep
+		for _, r := range rows {
+			// Collapse consecutive duplicate statuses (retry noise).
+			if len(out) > 0 && out[len(out)-1].S == r.Status {
+				continue
+			}
+			out = append(out, pipelineStep{S: r.Status, T: memCreatedString(r.Created)})
+		}
+		if b, err := json.Marshal(out); err == nil {
+			records[i].Pipeline = string(b)
+		}
+	}
+}
+
+// ══════════════════════════════════════════════════════════════
+//  CLEANUP (stuck installing + retention)
+// ══════════════════════════════════════════════════════════════
+
+// stuckRows returns in-progress rows older than stuckHours without a terminal
+// row, oldest first. Caller holds mu.
+func (m *MemStore) stuckRows(stuckHours int) []memRow {
+	cutoff := time.Now().Add(-time.Duration(stuckHours) * time.Hour)
+	terminal := m.terminalIDs()
+	var out []memRow
+	for _, r := range m.rows {
+		if (r.Status == "installing" || r.Status == "configuring") && r.Created.Before(cutoff) &&
+			(r.ExecutionID == "" || !terminal[r.ExecutionID]) {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out
+}
+
+func (m *MemStore) FindStuckInstallations(ctx context.Context, stuckHours int) ([]StuckRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rows := m.stuckRows(stuckHours)
+	if len(rows) > 500 {
+		rows = rows[:500]
+	}
+	out := make([]StuckRecord, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, StuckRecord{ID: r.ID, NSAPP: r.NSAPP, Created: memCreatedString(r.Created)})
+	}
+	return out, nil
+}
+
+func (m *MemStore) MarkRecordAsUnknown(ctx context.Context, record StuckRecord, stuckHours int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rows {
+		if r.ID != record.ID {
+			continue
+		}
+		m.rows = append(m.rows, memRow{
+			TelemetryOut: TelemetryOut{
+				NSAPP:         r.NSAPP,
+				Type:          r.Type,
+				Status:        "unknown",
+				Error:         fmt.Sprintf("Installation timed out - no completion status received after %dh", stuckHours),
+				ErrorCategory: "timeout",
+				ExecutionID:   r.ExecutionID,
+				RandomID:      r.RandomID,
+				RepoSource:    r.RepoSource,
+				ScriptVersion: r.ScriptVersion,
+				ScriptCommit:  r.ScriptCommit,
+			},
+			ID:      generateRecordID(),
+			Created: time.Now().UTC(),
+		})
+		return nil
+	}
+	return nil
+}
+
+func (m *MemStore) GetStuckCount(ctx context.Context, stuckHours int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.stuckRows(stuckHours)), nil
+}
+
+func (m *MemStore) DeleteOldRecords(ctx context.Context, retentionDays int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	kept := make([]memRow, 0, len(m.rows))
+	for _, r := range m.rows {
+		if !r.Created.Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	m.rows = kept
+	return nil
+}
+
+func (m *MemStore) RetentionStats(ctx context.Context, retentionDays int) (int, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	eligible := 0
+	var oldest time.Time
+	for _, r := range m.rows {
+		if r.Created.Before(cutoff) {
+			eligible++
+		}
+		if oldest.IsZero() || r.Created.Before(oldest) {
+			oldest = r.Created
+		}
+	}
+	if oldest.IsZero() {
+		return eligible, "", nil
+	}
+	return eligible, memDay(oldest), nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  DEAD LETTERS
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) InsertDeadLetters(ctx context.Context, rows []DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	// Same 30 day TTL as the ClickHouse table.
+	cutoff := now.AddDate(0, 0, -30)
+	kept := m.dead[:0]
+	for _, dl := range m.dead {
+		if !dl.created.Before(cutoff) {
+			kept = append(kept, dl)
+		}
+	}
+	m.dead = kept
+	for _, dl := range rows {
+		dl.Created = now.Format(time.RFC3339)
+		m.dead = append(m.dead, memDeadLetter{DeadLetter: dl, created: now})
+	}
+	return nil
+}
+
+func (m *MemStore) FetchDeadLetters(ctx context.Context, stage, reason string, page, limit int) ([]DeadLetter, uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var match []DeadLetter
+	for i := len(m.dead) - 1; i >= 0; i-- { // newest first
+		dl := m.dead[i]
+		if (stage == "" || dl.Stage == stage) && (reason == "" || dl.Reason == reason) {
+			match = append(match, dl.DeadLetter)
+		}
+	}
+	total := uint64(len(match))
+	offset := (page - 1) * limit
+	if offset > len(match) {
+		offset = len(match)
+	}
+	end := offset + limit
+	if end > len(match) {
+		end = len(match)
+	}
+	return match[offset:end], total, nil
+}
+
+func (m *MemStore) FetchDeadLettersByID(ctx context.Context, ids []string) ([]DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	var out []DeadLetter
+	for _, dl := range m.dead {
+		if want[dl.ID] {
+			out = append(out, dl.DeadLetter)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemStore) FetchDeadLetterSummary(ctx context.Context, days int) ([]DeadLetterReason, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	since := chSinceTime(days)
+	type agg struct {
+		count uint64
+		last  time.Time
+	}
+	groups := make(map[[2]string]*agg)
+	for _, dl := range m.dead {
+		if dl.created.Before(since) {
+			continue
+		}
+		k := [2]string{dl.Stage, dl.Reason}
+		g := groups[k]
+		if g == nil {
+			g = &agg{}
+			groups[k] = g
+		}
+		g.count++
+		if dl.created.After(g.last) {
+			g.last = dl.created
+		}
+	}
+	out := make([]DeadLetterReason, 0, len(groups))
+	for k, g := range groups {
+		out = append(out, DeadLetterReason{Stage: k[0], Reason: k[1], Count: g.count, LastSeen: g.last.Format(time.RFC3339)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	if len(out) > 200 {
+		out = out[:200]
+	}
+	return out, nil
+}
+
+func (m *MemStore) DeleteDeadLetters(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	kept := m.dead[:0]
+	for _, dl := range m.dead {
+		if !drop[dl.ID] {
+			kept = append(kept, dl)
+		}
+	}
+	m.dead = kept
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// ---------- Install method outcomes ----------
+// mv_daily_method only counts how often each install method ("default",
+// "advanced", "mydefaults-global", "mydefaults-app") is used. Outcomes and
+// error categories per (nsapp, method) show whether the advanced path or saved
+// defaults are a hidden source of failures: a method is flagged when its
+// failure rate is significantly above the other methods (overall or within the
+// same app).
+
+const (
+	// methodAppLimit caps the number of per-app breakdowns returned.
+	methodAppLimit = 100
+	// methodTopCategories is the number of error categories listed per method.
+	methodTopCategories = 3
+)
+
+// MethodOutcome holds the outcomes of one install method. SuccessRate is
+// success/(success+failed).
+type MethodOutcome struct {
+	Method        string          `json:"method"`
+	Total         int             `json:"total"`
+	Success       int             `json:"success"`
+	Failed        int             `json:"failed"`
+	Aborted       int             `json:"aborted"`
+	SuccessRate   float64         `json:"success_rate"`
+	ZScore        float64         `json:"z_score,omitempty"`
+	Flagged       bool            `json:"flagged"`
+	TopCategories []ErrorCatCount `json:"top_categories"`
+}
+
+// AppMethods is the per-method breakdown of one app.
+type AppMethods struct {
+	App     string          `json:"app"`
+	Total   int             `json:"total"`
+	Methods []MethodOutcome `json:"methods"`
+}
+
+// MethodData is the response of /api/methods.
+type MethodData struct {
+	Days    int             `json:"days"`
+	Methods []MethodOutcome `json:"methods"`
+	Apps    []AppMethods    `json:"apps"`
+}
+
+// methodCount is one (nsapp, method, error_category) aggregate.
+type methodCount struct {
+	app, method, category           string
+	total, success, failed, aborted int
+}
+
+// methodAcc accumulates the outcomes and failure categories of one method.
+type methodAcc struct {
+	MethodOutcome
+	cats map[string]int
+}
+
+func (a *methodAcc) add(c methodCount) {
+	a.Total += c.total
+	a.Success += c.success
+	a.Failed += c.failed
+	a.Aborted += c.aborted
+	if c.failed > 0 && c.category != "" && c.category != "user_aborted" {
+		a.cats[c.category] += c.failed
+	}
+}
+
+// methodOutcomes finishes a group of methods: success rates, top categories
+// and flags against the rest of the group, ordered by volume.
+func methodOutcomes(group map[string]*methodAcc) []MethodOutcome {
+	var success, failed int
+	for _, a := range group {
+		success += a.Success
+		failed += a.Failed
+	}
+	out := []MethodOutcome{}
+	for _, a := range group {
+		o := a.MethodOutcome
+		n := o.Success + o.Failed
+		if n > 0 {
+			o.SuccessRate = float64(o.Success) / float64(n) * 100
+		}
+		if restN := success + failed - n; n >= compatMinSamples && restN >= compatMinSamples {
+			o.ZScore = proportionZ(failed-o.Failed, restN, o.Failed, n)
+			o.Flagged = o.ZScore >= compatFlagZ
+		}
+		o.TopCategories = []ErrorCatCount{}
+		for _, c := range memTop(a.cats, methodTopCategories) {
+			o.TopCategories = append(o.TopCategories, ErrorCatCount{Category: c.Key, Count: c.Count})
+		}
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+// buildMethodData assembles the overall and per-app method breakdowns.
+func buildMethodData(days int, counts []methodCount) *MethodData {
+	overall := make(map[string]*methodAcc)
+	apps := make(map[string]map[string]*methodAcc)
+	get := func(group map[string]*methodAcc, method string) *methodAcc {
+		a, ok := group[method]
+		if !ok {
+			a = &methodAcc{MethodOutcome: MethodOutcome{Method: method}, cats: make(map[string]int)}
+			group[method] = a
+		}
+		return a
+	}
+	for _, c := range counts {
+		get(overall, c.method).add(c)
+		if apps[c.app] == nil {
+			apps[c.app] = make(map[string]*methodAcc)
+		}
+		get(apps[c.app], c.method).add(c)
+	}
+
+	data := &MethodData{Days: days, Methods: methodOutcomes(overall), Apps: []AppMethods{}}
+	for app, group := range apps {
+		am := AppMethods{App: app, Methods: methodOutcomes(group)}
+		for _, o := range am.Methods {
+			am.Total += o.Total
+		}
+		data.Apps = append(data.Apps, am)
+	}
+	sort.Slice(data.Apps, func(i, j int) bool {
+		if data.Apps[i].Total != data.Apps[j].Total {
+			return data.Apps[i].Total > data.Apps[j].Total
+		}
+		return data.Apps[i].App < data.Apps[j].App
+	})
+	if len(data.Apps) > methodAppLimit {
+		data.Apps = data.Apps[:methodAppLimit]
+	}
+	return data
+}
+
+// ══════════════════════════════════════════════════════════════
+//  METHOD OUTCOMES (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchMethodStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*MethodData, error) {
+	var query string
+	var args []interface{}
+	if repoSlug != "" {
+		extras := []string{"method != ''", "status IN ('success','failed','aborted','unknown')"}
+		if app != "" {
+			extras = append(extras, "nsapp = ?")
+		}
+		w, a := chWhere(days, repoSource, repoSlug, extras...)
+		if app != "" {
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT nsapp, method, error_category,
+				count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY nsapp, method, error_category`, w)
+		args = a
+	} else {
+		w, a := chMVWhere(days, repoSource)
+		if app != "" {
+			w += " AND nsapp = ?"
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT nsapp, method, error_category, sum(total), sum(success), sum(failed), sum(aborted)
+			FROM telemetry_db.mv_daily_app_method WHERE %s
+			GROUP BY nsapp, method, error_category`, w)
+		args = a
+	}
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH method stats: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []methodCount
+	for rows.Next() {
+		var c methodCount
+		var total, success, failed, aborted uint64
+		if err := rows.Scan(&c.app, &c.method, &c.category, &total, &success, &failed, &aborted); err != nil {
+			log.Printf("[CH] method stats scan: %v", err)
+			continue
+		}
+		c.total, c.success, c.failed, c.aborted = int(total), int(success), int(failed), int(aborted)
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildMethodData(days, counts), nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  METHOD OUTCOMES (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchMethodStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*MethodData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := make(map[[3]string]*methodCount)
+	for _, r := range m.rows {
+		if r.Method == "" || !isTerminalStatus(r.Status) || !memMatch(r, days, repoSource, repoSlug) ||
+			(app != "" && r.NSAPP != app) {
+			continue
+		}
+		key := [3]string{r.NSAPP, r.Method, r.ErrorCategory}
+		c, ok := groups[key]
+		if !ok {
+			c = &methodCount{app: r.NSAPP, method: r.Method, category: r.ErrorCategory}
+			groups[key] = c
+		}
+		c.total++
+		switch r.Status {
+		case "success":
+			c.success++
+		case "failed":
+			c.failed++
+		case "aborted":
+			c.aborted++
+		}
+	}
+
+	counts := make([]methodCount, 0, len(groups))
+	for _, c := range groups {
+		counts = append(counts, *c)
+	}
+	return buildMethodData(days, counts), nil
+}
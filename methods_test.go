@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildMethodData(t *testing.T) {
+	counts := []methodCount{
+		{app: "jellyfin", method: "default", total: 100, success: 95, failed: 5, category: "apt"},
+		{app: "jellyfin", method: "advanced", total: 15, success: 15},
+		{app: "jellyfin", method: "advanced", category: "storage", total: 10, failed: 10},
+		{app: "jellyfin", method: "advanced", category: "network", total: 3, failed: 3},
+		{app: "jellyfin", method: "advanced", category: "user_aborted", total: 4, failed: 4},
+		{app: "pihole", method: "default", total: 50, success: 48, failed: 1, aborted: 1},
+	}
+	data := buildMethodData(30, counts)
+
+	if len(data.Methods) != 2 || data.Methods[0].Method != "default" || data.Methods[0].Total != 150 {
+		t.Fatalf("methods = %+v, want default (150 installs) first", data.Methods)
+	}
+	adv := data.Methods[1]
+	if !adv.Flagged || data.Methods[0].Flagged {
+		t.Errorf("flags = default %v, advanced %v; want only advanced flagged", data.Methods[0].Flagged, adv.Flagged)
+	}
+	if adv.SuccessRate != float64(15)/32*100 {
+		t.Errorf("advanced success rate = %v, want 15/32", adv.SuccessRate)
+	}
+	// User aborts are not a failure category of the method.
+	wantCats := []ErrorCatCount{{Category: "storage", Count: 10}, {Category: "network", Count: 3}}
+	if !reflect.DeepEqual(adv.TopCategories, wantCats) {
+		t.Errorf("advanced categories = %+v, want %+v", adv.TopCategories, wantCats)
+	}
+
+	if len(data.Apps) != 2 || data.Apps[0].App != "jellyfin" || data.Apps[0].Total != 132 {
+		t.Fatalf("apps = %+v, want jellyfin (132 installs) first", data.Apps)
+	}
+	// A single method has nothing to be compared against.
+	if pi := data.Apps[1]; len(pi.Methods) != 1 || pi.Methods[0].Flagged || pi.Methods[0].ZScore != 0 {
+		t.Errorf("pihole methods = %+v, want one unflagged method", pi.Methods)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ---------- Ingest pipeline metrics ----------
+// In-process counters for the ingest path, exposed on /metrics next to the
+// ClickHouse aggregates. They reset on restart (Prometheus handles that via
+// rate()), and make it visible when a client release starts sending payloads
+// that need sanitizing, rescuing or get rejected.
+
+// counter is a monotonically increasing value.
+type counter struct{ v atomic.Uint64 }
+
+func (c *counter) Inc()          { c.v.Add(1) }
+func (c *counter) Add(n int)     { c.v.Add(uint64(n)) }
+func (c *counter) Value() uint64 { return c.v.Load() }
+
+// counterVec is a counter with a single label.
+type counterVec struct {
+	label string
+	mu    sync.Mutex
+	vals  map[string]uint64
+}
+
+func newCounterVec(label string) *counterVec {
+	return &counterVec{label: label, vals: make(map[string]uint64)}
+}
+
+func (c *counterVec) Inc(value string) { c.Add(value, 1) }
+
+func (c *counterVec) Add(value string, n int) {
+	c.mu.Lock()
+	c.vals[value] += uint64(n)
+	c.mu.Unlock()
+}
+
+func (c *counterVec) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]uint64, len(c.vals))
+	for k, v := range c.vals {
+		out[k] = v
+	}
+	return out
+}
+
+// histogram tracks observations in cumulative buckets (seconds).
+type histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64 // one per bucket, plus +Inf
+	sumNs   atomic.Int64
+	count   atomic.Uint64
+}
+
+func newHistogram(buckets ...float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+}
+
+func (h *histogram) Observe(d time.Duration) {
+	s := d.Seconds()
+	i := sort.SearchFloat64s(h.buckets, s)
+	h.counts[i].Add(1)
+	h.sumNs.Add(int64(d))
+	h.count.Add(1)
+}
+
+var (
+	metricRateLimited        = &counter{}
+	metricDecode             = newCounterVec("outcome") // clean, sanitized, rescued, failed
+	metricValidationReject   = newCounterVec("reason")  // "field: rule"
+	metricEnumFallback       = newCounterVec("field")
+	metricReclassified       = newCounterVec("rule")  // exit_code_0, addon_pve, abort_signal
+	metricQueueDropped       = newCounterVec("stage") // enqueue, retry
+	metricDedupSkipped       = newCounterVec("kind")  // installing, terminal_memory, terminal_db
+	metricWriteRetries       = &counter{}
+	metricWriteFailures      = &counter{}
+	metricSpillFailures      = &counter{}
+	metricDeadLettersDropped = newCounterVec("cause") // cap, buffer, stopped
+	metricInsertLatency      = newHistogram(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30)
+)
+
+func writeCounter(w io.Writer, name, help string, c *counter) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	fmt.Fprintf(w, "%s %d\n\n", name, c.Value())
+}
+
+func writeCounterVec(w io.Writer, name, help string, c *counterVec) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	vals := c.snapshot()
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, c.label, k, vals[k])
+	}
+	fmt.Fprintln(w)
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	var cum uint64
+	for i, b := range h.buckets {
+		cum += h.counts[i].Load()
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, b, cum)
+	}
+	cum += h.counts[len(h.buckets)].Load()
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cum)
+	fmt.Fprintf(w, "%s_sum %g\n", name, time.Duration(h.sumNs.Load()).Seconds())
+	fmt.Fprintf(w, "%s_count %d\n\n", name, h.count.Load())
+}
+
+// writeIngestMetrics appends the ingest pipeline metrics in Prometheus text format.
+func writeIngestMetrics(w io.Writer, queueLen int) {
+	writeCounter(w, "telemetry_ingest_rate_limited_total", "Requests rejected by the rate limiter", metricRateLimited)
+	writeCounterVec(w, "telemetry_ingest_decode_total", "Payloads by JSON decode outcome", metricDecode)
+	writeCounterVec(w, "telemetry_ingest_validation_rejected_total", "Payloads rejected by validation", metricValidationReject)
+	writeCounterVec(w, "telemetry_ingest_enum_fallback_total", "Enum values replaced with \"unknown\"", metricEnumFallback)
+	writeCounterVec(w, "telemetry_ingest_reclassified_total", "Events reclassified server-side", metricReclassified)
+	writeCounterVec(w, "telemetry_queue_dropped_total", "Events dropped because the write queue was full", metricQueueDropped)
+	writeCounterVec(w, "telemetry_queue_dedup_skipped_total", "Duplicate events skipped by the write workers", metricDedupSkipped)
+	writeCounter(w, "telemetry_queue_retries_total", "Events scheduled for another write attempt", metricWriteRetries)
+	writeCounter(w, "telemetry_queue_final_failures_total", "Events given up on after all write attempts", metricWriteFailures)
+	writeCounter(w, "telemetry_wal_spill_failures_total", "Retries that could not be re-journaled and were requeued in memory", metricSpillFailures)
+	writeCounterVec(w, "telemetry_dead_letters_dropped_total", "Dead letters not stored (daily per-reason cap, full buffer or shutdown)", metricDeadLettersDropped)
+	writeHistogram(w, "telemetry_insert_duration_seconds", "Latency of batch INSERTs", metricInsertLatency)
+	fmt.Fprintf(w, "# HELP telemetry_queue_length Events waiting to be written\n")
+	fmt.Fprintf(w, "# TYPE telemetry_queue_length gauge\n")
+	fmt.Fprintf(w, "telemetry_queue_length %d\n", queueLen)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ---------- Resource adequacy ----------
+// OOM kills (exit 137), "no space left" and similar failures depend on the
+// RAM, disk and cores the container/VM was created with. Allocations are
+// bucketed per app and the rate of resource-related failures (category
+// "resource" for RAM/cores, "storage" for disk) is computed per bucket. Where
+// small allocations fail noticeably more often than larger ones, the smallest
+// adequate bucket is recommended as minimum, giving maintainers data for
+// tuning script defaults.
+
+const (
+	// resourceMinSamples is the number of finished installs a bucket needs to
+	// be considered for a recommendation.
+	resourceMinSamples = 10
+	// resourceMinFailed is the minimum number of resource failures in a bucket
+	// before it counts as inadequate.
+	resourceMinFailed = 3
+	// resourceMaxRate is the resource failure rate (percent) above which a
+	// bucket counts as inadequate.
+	resourceMaxRate = 5.0
+	// resourceAppLimit caps the number of apps returned.
+	resourceAppLimit = 100
+)
+
+// resourceDim describes one allocation dimension: its column, the error
+// category that counts as a related failure and the lower bucket bounds.
+type resourceDim struct {
+	name      string
+	col       string
+	category  string
+	bounds    []int
+	recommend bool
+}
+
+var resourceDims = []resourceDim{
+	{name: "ram", col: "ram_size", category: "resource", bounds: []int{0, 512, 1024, 2048, 4096, 8192, 16384}, recommend: true},
+	{name: "disk", col: "disk_size", category: "storage", bounds: []int{0, 2, 4, 8, 16, 32, 64}, recommend: true},
+	{name: "cores", col: "core_count", category: "resource", bounds: []int{1, 2, 4, 8, 16}},
+}
+
+// ResourceBucket holds the finished installs of one allocation range
+// [Min, Max); Max is 0 for the open-ended last bucket.
+type ResourceBucket struct {
+	Min         int     `json:"min"`
+	Max         int     `json:"max,omitempty"`
+	Total       int     `json:"total"`
+	Failed      int     `json:"failed"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// ResourceDimension is the bucketed view of one allocation (RAM in MB, disk in
+// GB, cores). Recommended is the suggested minimum (0 if the data shows no
+// inadequate allocation or no adequate one to recommend).
+type ResourceDimension struct {
+	Median      int              `json:"median"`
+	Recommended int              `json:"recommended,omitempty"`
+	Buckets     []ResourceBucket `json:"buckets"`
+}
+
+// AppResources is the resource analysis of one app.
+type AppResources struct {
+	App      string            `json:"app"`
+	Installs int               `json:"installs"`
+	RAM      ResourceDimension `json:"ram"`
+	Disk     ResourceDimension `json:"disk"`
+	Cores    ResourceDimension `json:"cores"`
+}
+
+// ResourceRecommendation is an app whose recommended minimum RAM or disk is
+// above what it is typically (median) installed with.
+type ResourceRecommendation struct {
+	App        string `json:"app"`
+	RAM        int    `json:"ram,omitempty"`
+	RAMMedian  int    `json:"ram_median"`
+	Disk       int    `json:"disk,omitempty"`
+	DiskMedian int    `json:"disk_median"`
+}
+
+// ResourceData is the response of /api/resources.
+type ResourceData struct {
+	Days            int                      `json:"days"`
+	Apps            []AppResources           `json:"apps"`
+	Recommendations []ResourceRecommendation `json:"recommendations"`
+}
+
+// resourceCount is the number of finished installs of one app with one
+// allocation value, and how many of them failed with the related category.
+type resourceCount struct {
+	app      string
+	value    int
+	finished int
+	failed   int
+}
+
+// bucketIndex returns the bucket of value (-1 if below the first bound).
+func (d resourceDim) bucketIndex(value int) int {
+	return sort.SearchInts(d.bounds, value+1) - 1
+}
+
+// buildDimension buckets the per-value counts of one app and derives the
+// median allocation and the recommended minimum.
+func (d resourceDim) buildDimension(counts []resourceCount) ResourceDimension {
+	dim := ResourceDimension{Buckets: []ResourceBucket{}}
+	buckets := make([]ResourceBucket, len(d.bounds))
+	for i, b := range d.bounds {
+		buckets[i].Min = b
+		if i+1 < len(d.bounds) {
+			buckets[i].Max = d.bounds[i+1]
+		}
+	}
+
+	sort.Slice(counts, func(i, j int) bool { return counts[i].value < counts[j].value })
+	total := 0
+	for _, c := range counts {
+		total += c.finished
+	}
+	seen := 0
+	for _, c := range counts {
+		if dim.Median == 0 && (seen+c.finished)*2 >= total && total > 0 {
+			dim.Median = c.value
+		}
+		seen += c.finished
+		if i := d.bucketIndex(c.value); i >= 0 {
+			buckets[i].Total += c.finished
+			buckets[i].Failed += c.failed
+		}
+	}
+
+	// The recommendation is the first adequate bucket above the largest
+	// inadequate one; without an adequate bucket there is nothing to back it.
+	worst := -1
+	for i := range buckets {
+		b := &buckets[i]
+		if b.Total == 0 {
+			continue
+		}
+		b.FailureRate = float64(b.Failed) / float64(b.Total) * 100
+		if b.Total >= resourceMinSamples && b.Failed >= resourceMinFailed && b.FailureRate > resourceMaxRate {
+			worst = i
+		}
+		dim.Buckets = append(dim.Buckets, *b)
+	}
+	if d.recommend && worst >= 0 {
+		for _, b := range buckets[worst+1:] {
+			if b.Total >= resourceMinSamples && b.FailureRate <= resourceMaxRate {
+				dim.Recommended = b.Min
+				break
+			}
+		}
+	}
+	return dim
+}
+
+// buildResourceData assembles the response from per-dimension counts (in
+// resourceDims order). Only apps with at least one related failure are listed,
+// most RAM and disk failures first.
+func buildResourceData(days int, counts [][]resourceCount) *ResourceData {
+	type appCounts struct {
+		dims     [][]resourceCount
+		finished []int
+		failed   []int
+	}
+	apps := make(map[string]*appCounts)
+	for d, list := range counts {
+		for _, c := range list {
+			a, ok := apps[c.app]
+			if !ok {
+				a = &appCounts{
+					dims:     make([][]resourceCount, len(resourceDims)),
+					finished: make([]int, len(resourceDims)),
+					failed:   make([]int, len(resourceDims)),
+				}
+				apps[c.app] = a
+			}
+			a.dims[d] = append(a.dims[d], c)
+			a.finished[d] += c.finished
+			a.failed[d] += c.failed
+		}
+	}
+
+	data := &ResourceData{Days: days, Apps: []AppResources{}, Recommendations: []ResourceRecommendation{}}
+	failed := make(map[string]int)
+	for name, a := range apps {
+		if a.failed[0]+a.failed[1]+a.failed[2] == 0 {
+			continue
+		}
+		failed[name] = a.failed[0] + a.failed[1]
+		// Installs without a reported allocation are missing from its
+		// dimension, so the largest dimension is the best install count.
+		installs := 0
+		for _, n := range a.finished {
+			if n > installs {
+				installs = n
+			}
+		}
+		ar := AppResources{
+			App:      name,
+			Installs: installs,
+			RAM:      resourceDims[0].buildDimension(a.dims[0]),
+			Disk:     resourceDims[1].buildDimension(a.dims[1]),
+			Cores:    resourceDims[2].buildDimension(a.dims[2]),
+		}
+		data.Apps = append(data.Apps, ar)
+		if ar.RAM.Recommended > ar.RAM.Median || ar.Disk.Recommended > ar.Disk.Median {
+			rec := ResourceRecommendation{App: name, RAMMedian: ar.RAM.Median, DiskMedian: ar.Disk.Median}
+			if ar.RAM.Recommended > ar.RAM.Median {
+				rec.RAM = ar.RAM.Recommended
+			}
+			if ar.Disk.Recommended > ar.Disk.Median {
+				rec.Disk = ar.Disk.Recommended
+			}
+			data.Recommendations = append(data.Recommendations, rec)
+		}
+	}
+	sort.Slice(data.Apps, func(i, j int) bool {
+		a, b := data.Apps[i], data.Apps[j]
+		if failed[a.App] != failed[b.App] {
+			return failed[a.App] > failed[b.App]
+		}
+		return a.App < b.App
+	})
+	if len(data.Apps) > resourceAppLimit {
+		data.Apps = data.Apps[:resourceAppLimit]
+	}
+	sort.Slice(data.Recommendations, func(i, j int) bool {
+		a, b := data.Recommendations[i], data.Recommendations[j]
+		if failed[a.App] != failed[b.App] {
+			return failed[a.App] > failed[b.App]
+		}
+		return a.App < b.App
+	})
+	return data
+}
+
+// resourceRecommendationText formats a recommendation for the weekly report,
+// e.g. "RAM ≥ 2048 MB (median 1024), disk ≥ 8 GB (median 4)".
+func resourceRecommendationText(rec ResourceRecommendation) string {
+	var parts []string
+	if rec.RAM > 0 {
+		parts = append(parts, fmt.Sprintf("RAM ≥ %d MB (median %d)", rec.RAM, rec.RAMMedian))
+	}
+	if rec.Disk > 0 {
+		parts = append(parts, fmt.Sprintf("disk ≥ %d GB (median %d)", rec.Disk, rec.DiskMedian))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ══════════════════════════════════════════════════════════════
+//  RESOURCE ADEQUACY (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchResourceStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*ResourceData, error) {
+	extras := []string{"(status = 'success' OR (status = 'failed' AND error_category != 'user_aborted'))"}
+	if app != "" {
+		extras = append(extras, "nsapp = ?")
+	}
+	w, args := chWhere(days, repoSource, repoSlug, extras...)
+	if app != "" {
+		args = append(args, app)
+	}
+
+	counts := make([][]resourceCount, len(resourceDims))
+	for i, d := range resourceDims {
+		rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT nsapp, toUInt32(%s) v, count(), countIf(status = 'failed' AND error_category = '%s')
+			FROM telemetry_db.telemetry WHERE %s AND %s > 0
+			GROUP BY nsapp, v`, d.col, d.category, w, d.col), args...)
+		if err != nil {
+			return nil, fmt.Errorf("CH resource stats (%s): %w", d.name, err)
+		}
+		for rows.Next() {
+			var c resourceCount
+			var v uint32
+			var finished, failed uint64
+			if err := rows.Scan(&c.app, &v, &finished, &failed); err != nil {
+				log.Printf("[CH] resource stats scan: %v", err)
+				continue
+			}
+			c.value, c.finished, c.failed = int(v), int(finished), int(failed)
+			counts[i] = append(counts[i], c)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buildResourceData(days, counts), nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  RESOURCE ADEQUACY (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchResourceStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*ResourceData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type key struct {
+		app   string
+		value int
+	}
+	groups := make([]map[key]*resourceCount, len(resourceDims))
+	for i := range groups {
+		groups[i] = make(map[key]*resourceCount)
+	}
+	for _, r := range m.rows {
+		if !memMatch(r, days, repoSource, repoSlug) || (app != "" && r.NSAPP != app) {
+			continue
+		}
+		if r.Status != "success" && (r.Status != "failed" || r.ErrorCategory == "user_aborted") {
+			continue
+		}
+		for i, v := range []int{r.RAMSize, r.DiskSize, r.CoreCount} {
+			if v <= 0 {
+				continue
+			}
+			k := key{r.NSAPP, v}
+			c, ok := groups[i][k]
+			if !ok {
+				c = &resourceCount{app: r.NSAPP, value: v}
+				groups[i][k] = c
+			}
+			c.finished++
+			if r.Status == "failed" && r.ErrorCategory == resourceDims[i].category {
+				c.failed++
+			}
+		}
+	}
+
+	counts := make([][]resourceCount, len(resourceDims))
+	for i, g := range groups {
+		for _, c := range g {
+			counts[i] = append(counts[i], *c)
+		}
+	}
+	return buildResourceData(days, counts), nil
+}
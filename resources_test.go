@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceDimBuildDimension(t *testing.T) {
+	ram, cores := resourceDims[0], resourceDims[2]
+	tests := []struct {
+		name       string
+		dim        resourceDim
+		counts     []resourceCount
+		median     int
+		recommend  int
+		bucketMins []int
+	}{
+		{
+			name: "small allocation fails, next bucket is adequate",
+			dim:  ram,
+			counts: []resourceCount{
+				{value: 2048, finished: 30},
+				{value: 512, finished: 20, failed: 6},
+				{value: 1024, finished: 20, failed: 1},
+			},
+			median:     1024,
+			recommend:  1024,
+			bucketMins: []int{512, 1024, 2048},
+		},
+		{
+			name: "no adequate bucket above the failing one",
+			dim:  ram,
+			counts: []resourceCount{
+				{value: 512, finished: 20, failed: 6},
+				{value: 1024, finished: 20, failed: 5},
+				{value: 2048, finished: 5},
+			},
+			median:     1024,
+			bucketMins: []int{512, 1024, 2048},
+		},
+		{
+			name: "adequate bucket needs resourceMinSamples",
+			dim:  ram,
+			counts: []resourceCount{
+				{value: 512, finished: 20, failed: 6},
+				{value: 4096, finished: 9},
+				{value: 8192, finished: 10},
+			},
+			median:     512,
+			recommend:  8192,
+			bucketMins: []int{512, 4096, 8192},
+		},
+		{
+			name: "too few failures to count as inadequate",
+			dim:  ram,
+			counts: []resourceCount{
+				{value: 512, finished: 10, failed: 2},
+				{value: 2048, finished: 20},
+			},
+			median:     2048,
+			bucketMins: []int{512, 2048},
+		},
+		{
+			name: "cores are not recommended",
+			dim:  cores,
+			counts: []resourceCount{
+				{value: 1, finished: 20, failed: 10},
+				{value: 2, finished: 20},
+			},
+			median:     1,
+			bucketMins: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		d := tt.dim.buildDimension(tt.counts)
+		if d.Median != tt.median || d.Recommended != tt.recommend {
+			t.Errorf("%s: median %d, recommended %d; want %d, %d", tt.name, d.Median, d.Recommended, tt.median, tt.recommend)
+		}
+		var mins []int
+		for _, b := range d.Buckets {
+			mins = append(mins, b.Min)
+		}
+		if !reflect.DeepEqual(mins, tt.bucketMins) {
+			t.Errorf("%s: buckets %v, want %v", tt.name, mins, tt.bucketMins)
+		}
+	}
+}
+
+func TestBuildResourceDataRecommendations(t *testing.T) {
+	counts := [][]resourceCount{
+		{
+			{app: "immich", value: 1024, finished: 40, failed: 8},
+			{app: "immich", value: 4096, finished: 30},
+			{app: "immich", value: 8192, finished: 10},
+			{app: "pihole", value: 512, finished: 50},
+		},
+		{
+			{app: "immich", value: 8, finished: 60},
+			{app: "pihole", value: 2, finished: 50},
+		},
+		nil,
+	}
+	data := buildResourceData(30, counts)
+
+	// pihole never failed for lack of resources, so it is left out.
+	if len(data.Apps) != 1 || data.Apps[0].App != "immich" || data.Apps[0].Installs != 80 {
+		t.Fatalf("apps = %+v, want only immich with 80 installs", data.Apps)
+	}
+	want := []ResourceRecommendation{{App: "immich", RAM: 4096, RAMMedian: 1024, DiskMedian: 8}}
+	if !reflect.DeepEqual(data.Recommendations, want) {
+		t.Errorf("recommendations = %+v, want %+v", data.Recommendations, want)
+	}
+}
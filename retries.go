@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// ---------- Retry chains ----------
+// After a failed install users often rerun the same script right away. Each
+// run is its own execution_id under the same session random_id, so the
+// finished executions of one (random_id, nsapp) are linked into retry chains:
+// a chain continues while the previous attempt failed and the next one started
+// within the retry window, and ends with the first success. Comparing the
+// first-attempt and the eventual success rate separates flaky scripts (a
+// rerun usually works) from broken ones (reruns fail as well).
+
+const (
+	// retryDefaultWindow is the maximum gap between two attempts of a chain.
+	retryDefaultWindow = 6 * time.Hour
+	// retryMinChains is the number of chains an app needs to be listed.
+	retryMinChains = 10
+	// retryAppLimit caps the number of apps returned.
+	retryAppLimit = 100
+	// retryBrokenRate is the eventual success rate (percent) below which an
+	// app is considered broken.
+	retryBrokenRate = 50.0
+	// retryFlakyGain is the minimum gain (percentage points) from first-attempt
+	// to eventual success for an app to be considered flaky.
+	retryFlakyGain = 15.0
+)
+
+// RetryStats summarizes the retry chains of one app (or of all apps when App
+// is empty). AvgRetries is the mean number of reruns of chains whose first
+// attempt failed.
+type RetryStats struct {
+	App                 string  `json:"app,omitempty"`
+	Chains              int     `json:"chains"`
+	FirstAttemptSuccess int     `json:"first_attempt_success"`
+	EventualSuccess     int     `json:"eventual_success"`
+	FirstAttemptRate    float64 `json:"first_attempt_rate"`
+	EventualRate        float64 `json:"eventual_rate"`
+	Retried             int     `json:"retried"`
+	AvgRetries          float64 `json:"avg_retries"`
+	Verdict             string  `json:"verdict,omitempty"` // "flaky", "broken" or ""
+	retries             int
+}
+
+// add records one chain of attempts.
+func (s *RetryStats) add(attempts int, firstOK, ok bool) {
+	s.Chains++
+	if firstOK {
+		s.FirstAttemptSuccess++
+	} else if attempts > 1 {
+		s.Retried++
+		s.retries += attempts - 1
+	}
+	if ok {
+		s.EventualSuccess++
+	}
+}
+
+// finish computes the rates and the verdict.
+func (s *RetryStats) finish() {
+	if s.Chains == 0 {
+		return
+	}
+	s.FirstAttemptRate = float64(s.FirstAttemptSuccess) / float64(s.Chains) * 100
+	s.EventualRate = float64(s.EventualSuccess) / float64(s.Chains) * 100
+	if s.Retried > 0 {
+		s.AvgRetries = float64(s.retries) / float64(s.Retried)
+	}
+	if s.App != "" && s.Chains >= retryMinChains {
+		switch {
+		case s.EventualRate < retryBrokenRate:
+			s.Verdict = "broken"
+		case s.EventualRate-s.FirstAttemptRate >= retryFlakyGain:
+			s.Verdict = "flaky"
+		}
+	}
+}
+
+// RetryData is the response of /api/retries.
+type RetryData struct {
+	Days        int          `json:"days"`
+	WindowHours int          `json:"window_hours"`
+	Overall     RetryStats   `json:"overall"`
+	Apps        []RetryStats `json:"apps"`
+}
+
+// sortRetryApps orders apps by chain count and applies retryAppLimit.
+func (d *RetryData) sortRetryApps() {
+	sort.Slice(d.Apps, func(i, j int) bool {
+		if d.Apps[i].Chains != d.Apps[j].Chains {
+			return d.Apps[i].Chains > d.Apps[j].Chains
+		}
+		return d.Apps[i].App < d.Apps[j].App
+	})
+	if len(d.Apps) > retryAppLimit {
+		d.Apps = d.Apps[:retryAppLimit]
+	}
+}
+
+// ══════════════════════════════════════════════════════════════
+//  RETRY CHAINS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchRetryStats(ctx context.Context, days int, repoSource, repoSlug, app string, window time.Duration) (*RetryData, error) {
+	extras := []string{"execution_id != ''", "random_id != ''",
+		"status IN ('success','failed')", "error_category != 'user_aborted'"}
+	if app != "" {
+		extras = append(extras, "nsapp = ?")
+	}
+	w, args := chWhere(days, repoSource, repoSlug, extras...)
+	if app != "" {
+		args = append(args, app)
+	}
+
+	// Innermost: one row per finished execution. Then a chain starts at the
+	// first attempt of a session, after a success or after a gap longer than
+	// the window; the running sum of those starts numbers the chains. The
+	// overall row comes from WITH ROLLUP (nsapp = '').
+	query := fmt.Sprintf(`
+		SELECT nsapp, count() chains,
+			countIf(first_ok), countIf(ok),
+			countIf(NOT first_ok AND attempts > 1), sumIf(attempts - 1, NOT first_ok)
+		FROM (
+			SELECT nsapp, random_id, chain, count() attempts,
+				argMin(status, t) = 'success' AS first_ok,
+				countIf(status = 'success') > 0 AS ok
+			FROM (
+				SELECT nsapp, random_id, t, status,
+					sum(start) OVER (PARTITION BY random_id, nsapp ORDER BY t ROWS UNBOUNDED PRECEDING) AS chain
+				FROM (
+					SELECT nsapp, random_id, t, status,
+						if(row_number() OVER w = 1
+							OR lagInFrame(status) OVER w = 'success'
+							OR dateDiff('second', lagInFrame(t) OVER w, t) > %d, 1, 0) AS start
+					FROM (
+						SELECT nsapp, random_id, execution_id, max(created) t, argMax(status, created) status
+						FROM telemetry_db.telemetry WHERE %s
+						GROUP BY nsapp, random_id, execution_id
+					)
+					WINDOW w AS (PARTITION BY random_id, nsapp ORDER BY t ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)
+				)
+			)
+			GROUP BY nsapp, random_id, chain
+		)
+		GROUP BY nsapp WITH ROLLUP
+		ORDER BY chains DESC`, int(window.Seconds()), w)
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH retry stats: %w", err)
+	}
+	defer rows.Close()
+
+	data := &RetryData{Days: days, WindowHours: int(window.Hours()), Apps: []RetryStats{}}
+	for rows.Next() {
+		var s RetryStats
+		var chains, firstOK, ok, retried, retries uint64
+		if err := rows.Scan(&s.App, &chains, &firstOK, &ok, &retried, &retries); err != nil {
+			log.Printf("[CH] retry stats scan: %v", err)
+			continue
+		}
+		s.Chains, s.FirstAttemptSuccess, s.EventualSuccess = int(chains), int(firstOK), int(ok)
+		s.Retried, s.retries = int(retried), int(retries)
+		s.finish()
+		if s.App == "" {
+			data.Overall = s
+		} else if s.Chains >= retryMinChains || app != "" {
+			data.Apps = append(data.Apps, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	data.sortRetryApps()
+	return data, nil
+}
+
+// ══════════════════════════════════════════════════════════════
+//  RETRY CHAINS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchRetryStats(ctx context.Context, days int, repoSource, repoSlug, app string, window time.Duration) (*RetryData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Last finished event per execution, grouped by (random_id, nsapp).
+	type attempt struct {
+		t       time.Time
+		success bool
+	}
+	execs := make(map[string]*memRow)
+	for i := range m.rows {
+		r := &m.rows[i]
+		if r.ExecutionID == "" || r.RandomID == "" || (r.Status != "success" && r.Status != "failed") ||
+			r.ErrorCategory == "user_aborted" || !memMatch(*r, days, repoSource, repoSlug) || (app != "" && r.NSAPP != app) {
+			continue
+		}
+		if prev, ok := execs[r.ExecutionID]; !ok || !r.Created.Before(prev.Created) {
+			execs[r.ExecutionID] = r
+		}
+	}
+	sessions := make(map[[2]string][]attempt)
+	for _, r := range execs {
+		key := [2]string{r.RandomID, r.NSAPP}
+		sessions[key] = append(sessions[key], attempt{t: r.Created, success: r.Status == "success"})
+	}
+
+	overall := &RetryStats{}
+	apps := make(map[string]*RetryStats)
+	for key, attempts := range sessions {
+		sort.Slice(attempts, func(i, j int) bool { return attempts[i].t.Before(attempts[j].t) })
+		s, ok := apps[key[1]]
+		if !ok {
+			s = &RetryStats{App: key[1]}
+			apps[key[1]] = s
+		}
+		start := 0
+		for i := 1; i <= len(attempts); i++ {
+			if i < len(attempts) && !attempts[i-1].success && attempts[i].t.Sub(attempts[i-1].t) <= window {
+				continue
+			}
+			chain := attempts[start:i]
+			ok := chain[len(chain)-1].success
+			s.add(len(chain), chain[0].success, ok)
+			overall.add(len(chain), chain[0].success, ok)
+			start = i
+		}
+	}
+
+	overall.finish()
+	data := &RetryData{Days: days, WindowHours: int(window.Hours()), Overall: *overall, Apps: []RetryStats{}}
+	for _, s := range apps {
+		s.finish()
+		if s.Chains >= retryMinChains || app != "" {
+			data.Apps = append(data.Apps, *s)
+		}
+	}
+	data.sortRetryApps()
+	return data, nil
+}
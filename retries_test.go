@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemStoreRetryChains(t *testing.T) {
+	m := NewMemStore()
+	t0 := time.Now().UTC().Add(-48 * time.Hour)
+	add := func(session, status string, at time.Duration, mods ...func(*memRow)) {
+		r := memRow{
+			TelemetryOut: TelemetryOut{
+				RandomID: session, ExecutionID: session + "-" + at.String(),
+				NSAPP: "jellyfin", Status: status, RepoSource: "ProxmoxVE",
+			},
+			Created: t0.Add(at),
+		}
+		for _, mod := range mods {
+			mod(&r)
+		}
+		m.rows = append(m.rows, r)
+	}
+
+	// Two reruns, the last one works: one chain of three attempts.
+	add("s1", "failed", 0)
+	add("s1", "failed", time.Hour)
+	add("s1", "success", 2*time.Hour)
+	// A rerun exactly at the window continues the chain, one after it starts
+	// a new one.
+	add("s2", "failed", 0)
+	add("s2", "failed", 6*time.Hour)
+	add("s2", "failed", 12*time.Hour+time.Minute)
+	// A success ends the chain even if a failure follows right away.
+	add("s3", "success", 0)
+	add("s3", "failed", time.Hour)
+	add("s3", "success", 2*time.Hour)
+	// Ignored: user aborts, in-progress events, and earlier events of an
+	// execution that finished later.
+	add("s4", "failed", 0, func(r *memRow) { r.ErrorCategory = "user_aborted" })
+	add("s4", "installing", time.Minute)
+	add("s5", "failed", 0, func(r *memRow) { r.ExecutionID = "s5-x" })
+	add("s5", "success", time.Minute, func(r *memRow) { r.ExecutionID = "s5-x" })
+
+	data, err := m.FetchRetryStats(context.Background(), 30, "ProxmoxVE", "", "jellyfin", 6*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := data.Overall
+	// Chains: s1 [F F S], s2 [F F] [F], s3 [S] [F S], s5 [S].
+	if o.Chains != 6 || o.FirstAttemptSuccess != 2 || o.EventualSuccess != 4 || o.Retried != 3 {
+		t.Fatalf("overall = %+v, want 6 chains, 2 first-attempt and 4 eventual successes, 3 retried", o)
+	}
+	if o.AvgRetries != float64(4)/3 {
+		t.Errorf("avg retries = %v, want 4/3", o.AvgRetries)
+	}
+	if len(data.Apps) != 1 || data.Apps[0].App != "jellyfin" || data.Apps[0].Chains != 6 {
+		t.Errorf("apps = %+v, want jellyfin with 6 chains", data.Apps)
+	}
+	if data.WindowHours != 6 {
+		t.Errorf("window hours = %d, want 6", data.WindowHours)
+	}
+
+	// A shorter window splits s1 after the first failure as well.
+	data, _ = m.FetchRetryStats(context.Background(), 30, "ProxmoxVE", "", "jellyfin", 30*time.Minute)
+	if o := data.Overall; o.Chains != 10 || o.EventualSuccess != 4 {
+		t.Errorf("overall with 30m window = %+v, want 10 chains, 4 eventual successes", o)
+	}
+}
+
+func TestRetryStatsVerdict(t *testing.T) {
+	tests := []struct {
+		name                string
+		chains, first, ever int
+		want                string
+	}{
+		{"too few chains", 5, 0, 0, ""},
+		{"broken", 20, 4, 8, "broken"},
+		{"flaky", 20, 10, 16, "flaky"},
+		{"healthy", 20, 18, 19, ""},
+	}
+	for _, tt := range tests {
+		s := RetryStats{App: "x", Chains: tt.chains, FirstAttemptSuccess: tt.first, EventualSuccess: tt.ever}
+		s.finish()
+		if s.Verdict != tt.want {
+			t.Errorf("%s: verdict %q, want %q", tt.name, s.Verdict, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Per-revision failure rates ----------
+// Scripts may report the revision they were run from (script_version and/or
+// script_commit). Outcomes are aggregated per app and revision so a jump in
+// failures can be attributed to the change that introduced it. Revisions of an
+// app are ordered by their first appearance ever (not within the window, where
+// every revision still in use would show up on the first day); each one is
+// compared against its predecessor with a two-proportion z-test.
+
+const (
+	// revisionMinSamples is the number of finished installs (success + failed)
+	// both revisions need before they are compared.
+	revisionMinSamples = 20
+	// revisionRegressionZ is the z-score above which a revision is flagged
+	// (one-sided, ~97.5%).
+	revisionRegressionZ = 1.96
+	// revisionMaxRows bounds the revisions returned for all apps; a single
+	// app is never truncated.
+	revisionMaxRows = 5000
+)
+
+// RevisionStat holds the outcomes of one script revision.
+type RevisionStat struct {
+	Version     string  `json:"version,omitempty"`
+	Commit      string  `json:"commit,omitempty"`
+	FirstSeen   string  `json:"first_seen"`
+	LastSeen    string  `json:"last_seen"`
+	Total       int     `json:"total"`
+	Success     int     `json:"success"`
+	Failed      int     `json:"failed"`
+	Aborted     int     `json:"aborted"`
+	SuccessRate float64 `json:"success_rate"`
+	FailureRate float64 `json:"failure_rate"`
+	ZScore      float64 `json:"z_score,omitempty"`
+	Regression  bool    `json:"regression"`
+
+	introduced time.Time // first appearance ever, orders the revisions
+}
+
+// revisionKey identifies one revision of an app.
+type revisionKey struct{ app, typ, version, commit string }
+
+// AppRevisions lists the revisions seen for one app, oldest first.
+type AppRevisions struct {
+	App       string         `json:"app"`
+	Type      string         `json:"type"`
+	Revisions []RevisionStat `json:"revisions"`
+}
+
+// RevisionData is the response of /api/revisions.
+type RevisionData struct {
+	Days int            `json:"days"`
+	Apps []AppRevisions `json:"apps"`
+}
+
+// buildRevisionData groups revision rows by app, orders them by first
+// appearance ever and flags regressions against the previous revision.
+// Revisions introduced at the same time are ordered by version number.
+func buildRevisionData(days int, groups map[[2]string][]RevisionStat) *RevisionData {
+	data := &RevisionData{Days: days, Apps: []AppRevisions{}}
+	for key, revs := range groups {
+		sort.Slice(revs, func(i, j int) bool {
+			if !revs[i].introduced.Equal(revs[j].introduced) {
+				return revs[i].introduced.Before(revs[j].introduced)
+			}
+			if revs[i].Version != revs[j].Version {
+				return naturalLess(revs[i].Version, revs[j].Version)
+			}
+			return revs[i].Commit < revs[j].Commit
+		})
+		for i := range revs {
+			r := &revs[i]
+			finished := r.Success + r.Failed
+			if finished > 0 {
+				r.SuccessRate = float64(r.Success) / float64(finished) * 100
+				r.FailureRate = float64(r.Failed) / float64(finished) * 100
+			}
+			if i == 0 {
+				continue
+			}
+			p := revs[i-1]
+			prevFinished := p.Success + p.Failed
+			if finished < revisionMinSamples || prevFinished < revisionMinSamples {
+				continue
+			}
+			r.ZScore = proportionZ(p.Failed, prevFinished, r.Failed, finished)
+			r.Regression = r.ZScore >= revisionRegressionZ
+		}
+		data.Apps = append(data.Apps, AppRevisions{App: key[0], Type: key[1], Revisions: revs})
+	}
+	sort.Slice(data.Apps, func(i, j int) bool {
+		if data.Apps[i].App != data.Apps[j].App {
+			return data.Apps[i].App < data.Apps[j].App
+		}
+		return data.Apps[i].Type < data.Apps[j].Type
+	})
+	return data
+}
+
+// ══════════════════════════════════════════════════════════════
+//  REVISION STATS (ClickHouse)
+// ══════════════════════════════════════════════════════════════
+
+func (ch *CHClient) FetchRevisionStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*RevisionData, error) {
+	// Rows come ordered by app, so a limit can only cut the last app short;
+	// one row more than the limit tells whether that happened.
+	limit := ""
+	if app == "" {
+		limit = fmt.Sprintf("LIMIT %d", revisionMaxRows+1)
+	}
+	var query string
+	var args []interface{}
+	if repoSlug != "" {
+		extras := []string{"(script_version != '' OR script_commit != '')"}
+		if app != "" {
+			extras = append(extras, "nsapp = ?")
+		}
+		w, a := chWhere(days, repoSource, repoSlug, extras...)
+		if app != "" {
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT nsapp, type, script_version, script_commit,
+				min(toDate(created)), max(toDate(created)),
+				count(), countIf(status='success'), countIf(status='failed'), countIf(status='aborted')
+			FROM telemetry_db.telemetry WHERE %s
+			GROUP BY nsapp, type, script_version, script_commit
+			ORDER BY nsapp, type, script_version, script_commit
+			%s`, w, limit)
+		args = a
+	} else {
+		w, a := chMVWhere(days, repoSource)
+		if app != "" {
+			w += " AND nsapp = ?"
+			a = append(a, app)
+		}
+		query = fmt.Sprintf(`
+			SELECT nsapp, type, script_version, script_commit,
+				min(day), max(day),
+				sum(total), sum(success), sum(failed), sum(aborted)
+			FROM telemetry_db.mv_daily_revision WHERE %s
+			GROUP BY nsapp, type, script_version, script_commit
+			ORDER BY nsapp, type, script_version, script_commit
+			%s`, w, limit)
+		args = a
+	}
+
+	rows, err := ch.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("CH revision stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[revisionKey]*RevisionStat)
+	n := 0
+	for rows.Next() {
+		var k revisionKey
+		var s RevisionStat
+		var first, last time.Time
+		var total, success, failed, aborted uint64
+		if err := rows.Scan(&k.app, &k.typ, &k.version, &k.commit, &first, &last, &total, &success, &failed, &aborted); err != nil {
+			log.Printf("[CH] revision stats scan: %v", err)
+			continue
+		}
+		if n++; n > revisionMaxRows {
+			// Drop the app that was cut short rather than compare a
+			// revision against the wrong predecessor.
+			log.Printf("[CH] revision stats: more than %d revisions, leaving out %s (%s)", revisionMaxRows, k.app, k.typ)
+			for sk := range stats {
+				if sk.app == k.app && sk.typ == k.typ {
+					delete(stats, sk)
+				}
+			}
+			break
+		}
+		s.Version, s.Commit = k.version, k.commit
+		s.FirstSeen = first.Format("2006-01-02")
+		s.LastSeen = last.Format("2006-01-02")
+		s.Total, s.Success, s.Failed, s.Aborted = int(total), int(success), int(failed), int(aborted)
+		s.introduced = first
+		stats[k] = &s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := ch.fetchRevisionIntroduced(ctx, repoSource, app, stats); err != nil {
+		return nil, err
+	}
+
+	groups := make(map[[2]string][]RevisionStat)
+	for k, s := range stats {
+		key := [2]string{k.app, k.typ}
+		groups[key] = append(groups[key], *s)
+	}
+	return buildRevisionData(days, groups), nil
+}
+
+// fetchRevisionIntroduced sets the first appearance ever of the given
+// revisions from mv_revision_first_seen. The view is not split by repo_slug,
+// so with a slug filter a revision counts from its first install in the
+// repo_source. Revisions missing from the view keep their first day in the
+// window.
+func (ch *CHClient) fetchRevisionIntroduced(ctx context.Context, repoSource, app string, stats map[revisionKey]*RevisionStat) error {
+	parts := []string{"1=1"}
+	var args []interface{}
+	if pred, pArgs := repoSourcePred(repoSource); pred != "" {
+		parts = append(parts, pred)
+		args = append(args, pArgs...)
+	}
+	if app != "" {
+		parts = append(parts, "nsapp = ?")
+		args = append(args, app)
+	}
+	rows, err := ch.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT nsapp, type, script_version, script_commit, min(first_seen)
+		FROM telemetry_db.mv_revision_first_seen WHERE %s
+		GROUP BY nsapp, type, script_version, script_commit`, strings.Join(parts, " AND ")), args...)
+	if err != nil {
+		return fmt.Errorf("CH revision first seen: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k revisionKey
+		var first time.Time
+		if err := rows.Scan(&k.app, &k.typ, &k.version, &k.commit, &first); err != nil {
+			log.Printf("[CH] revision first seen scan: %v", err)
+			continue
+		}
+		if s, ok := stats[k]; ok {
+			s.introduced = first
+		}
+	}
+	return rows.Err()
+}
+
+// ══════════════════════════════════════════════════════════════
+//  REVISION STATS (in-memory)
+// ══════════════════════════════════════════════════════════════
+
+func (m *MemStore) FetchRevisionStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*RevisionData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make(map[revisionKey]*RevisionStat)
+	introduced := make(map[revisionKey]time.Time)
+	for _, r := range m.rows {
+		if (r.ScriptVersion == "" && r.ScriptCommit == "") || (app != "" && r.NSAPP != app) {
+			continue
+		}
+		k := revisionKey{r.NSAPP, r.Type, r.ScriptVersion, r.ScriptCommit}
+		// Mirrors mv_revision_first_seen, which has no repo_slug.
+		if t, ok := introduced[k]; memRepoMatch(r, repoSource) && (!ok || r.Created.Before(t)) {
+			introduced[k] = r.Created
+		}
+		if !memMatch(r, days, repoSource, repoSlug) {
+			continue
+		}
+		s, ok := stats[k]
+		day := memDay(r.Created)
+		if !ok {
+			s = &RevisionStat{Version: r.ScriptVersion, Commit: r.ScriptCommit, FirstSeen: day, LastSeen: day}
+			stats[k] = s
+		}
+		if day < s.FirstSeen {
+			s.FirstSeen = day
+		}
+		if day > s.LastSeen {
+			s.LastSeen = day
+		}
+		s.Total++
+		switch r.Status {
+		case "success":
+			s.Success++
+		case "failed":
+			s.Failed++
+		case "aborted":
+			s.Aborted++
+		}
+	}
+
+	groups := make(map[[2]string][]RevisionStat)
+	for k, s := range stats {
+		s.introduced = introduced[k]
+		key := [2]string{k.app, k.typ}
+		groups[key] = append(groups[key], *s)
+	}
+	return buildRevisionData(days, groups), nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ---------- Payload schema versions ----------
+// Every payload carries an optional schema_version. Payloads without one are
+// treated as version 1 (the contract api.func has been sending all along).
+// Each version has an upgrader that normalizes it into the current internal
+// shape before validation, so legacy fix-ups live in one place instead of
+// being spread over validate(). Decoding itself stays lenient for every
+// version: unknown fields are ignored so clients can add fields before the
+// server is updated.
+
+const currentSchemaVersion = 2
+
+// schemaVersion describes one published payload contract.
+type schemaVersion struct {
+	Version     int
+	Description string
+	Required    []string // JSON field names that must be present and non-empty
+	upgrade     func(in *TelemetryIn) error
+}
+
+var schemaVersions = map[int]schemaVersion{
+	1: {
+		Version:     1,
+		Description: "Legacy api.func payload. repo_source is derived from repo_slug when missing and the status typo \"sucess\" is accepted.",
+		Required:    []string{"random_id", "type", "nsapp", "status"},
+		upgrade:     upgradeV1,
+	},
+	2: {
+		Version:     2,
+		Description: "Explicit contract: execution_id and repo_source are required, legacy fix-ups are no longer applied.",
+		Required:    []string{"schema_version", "random_id", "execution_id", "type", "nsapp", "status", "repo_source"},
+		upgrade:     upgradeV2,
+	},
+}
+
+// upgradeV1 applies the fix-ups older clients rely on.
+func upgradeV1(in *TelemetryIn) error {
+	// Safety net: derive repo_source from repo_slug when the routing field is
+	// missing, so older/partial clients still land in the right bucket.
+	if in.RepoSource == "" && in.RepoSlug != "" {
+		switch {
+		case strings.HasSuffix(in.RepoSlug, "/ProxmoxVE"):
+			in.RepoSource = "ProxmoxVE"
+		case strings.HasSuffix(in.RepoSlug, "/ProxmoxVED"):
+			in.RepoSource = "ProxmoxVED"
+		default:
+			in.RepoSource = "external"
+		}
+	}
+
+	// Normalize common typos for backwards compatibility
+	if in.Status == "sucess" {
+		in.Status = "success"
+	}
+	return nil
+}
+
+// upgradeV2 enforces the fields that became mandatory in version 2.
+func upgradeV2(in *TelemetryIn) error {
+	problems := &ValidationError{}
+	if in.ExecutionID == "" {
+		problems.add("execution_id", "", "required")
+	}
+	if in.RepoSource == "" {
+		problems.add("repo_source", "", "required")
+	}
+	return problems.err()
+}
+
+// upgradeTelemetry runs the upgrader for the payload's schema_version. A
+// version newer than the server knows is handled as the current version so a
+// client update never blocks ingestion.
+func upgradeTelemetry(in *TelemetryIn, dryRun bool) error {
+	v := in.SchemaVersion
+	if v == 0 {
+		v = 1
+	}
+	if v > currentSchemaVersion {
+		if !dryRun {
+			log.Printf("[WARN] unknown schema_version %d from nsapp=%s, treating as %d", v, in.NSAPP, currentSchemaVersion)
+		}
+		v = currentSchemaVersion
+	}
+	sv, ok := schemaVersions[v]
+	if !ok {
+		return fmt.Errorf("invalid schema_version %d", in.SchemaVersion)
+	}
+	in.SchemaVersion = v
+	return sv.upgrade(in)
+}
+
+// ---------- JSON Schema generation ----------
+
+// fieldNotes documents server-side behavior that is not a constraint.
+var fieldNotes = map[string]string{
+	"schema_version": "Versions newer than the server knows are handled as the current one.",
+	"os_type":        "Checked against the known operating systems for lxc/vm only. \"-\" and \"none\" mean not applicable.",
+	"ct_type":        "Checked for new lxc/vm records only.",
+	"error":          "IP addresses are anonymized server-side.",
+	"error_category": "Overridden server-side when the category can be derived from exit_code/error.",
+	"script_commit":  "Git commit of the script (full or abbreviated SHA).",
+}
+
+// JSONSchemaFor builds the JSON Schema document for a payload version by
+// reflecting over TelemetryIn and applying the limits validate() enforces
+// (fieldMaxLength, fieldMaximum and fieldEnums).
+func JSONSchemaFor(version int) (map[string]interface{}, error) {
+	sv, ok := schemaVersions[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema version %d", version)
+	}
+
+	props := make(map[string]interface{})
+	t := reflect.TypeOf(TelemetryIn{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if name == "schema_version" && version == 1 {
+			continue
+		}
+
+		prop := make(map[string]interface{})
+		switch f.Type.Kind() {
+		case reflect.String:
+			prop["type"] = "string"
+		case reflect.Int, reflect.Int64:
+			prop["type"] = "integer"
+		case reflect.Bool:
+			prop["type"] = "boolean"
+		}
+
+		var notes []string
+		if n := fieldMaxLength[name]; n > 0 {
+			prop["maxLength"] = n
+		}
+		if max, ok := fieldMaximum[name]; ok {
+			prop["minimum"] = 0
+			prop["maximum"] = max
+		}
+		if name == "schema_version" {
+			prop["minimum"] = 1
+		}
+		if enum, ok := fieldEnums[name]; ok {
+			var values []string
+			for v := range enum.Values {
+				if v != "" {
+					values = append(values, v)
+				}
+			}
+			if name == "status" && version == 1 {
+				values = append(values, "sucess")
+			}
+			sort.Strings(values)
+			if enum.Reject {
+				prop["enum"] = values
+			} else {
+				// Unknown values are accepted and stored as "unknown", so
+				// the field is an open string with the known values listed.
+				prop["examples"] = values
+				notes = append(notes, "Unknown values are stored as \"unknown\".")
+			}
+		}
+		if n := fieldNotes[name]; n != "" {
+			notes = append(notes, n)
+		}
+		if len(notes) > 0 {
+			prop["description"] = strings.Join(notes, " ")
+		}
+		props[name] = prop
+	}
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  fmt.Sprintf("/api/schema?version=%d", version),
+		"title":                fmt.Sprintf("Telemetry payload v%d", version),
+		"description":          sv.Description,
+		"type":                 "object",
+		"required":             sv.Required,
+		"properties":           props,
+		"additionalProperties": true,
+	}, nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminPassword = "test-admin"
+
+// testServer serves newMux on top of a MemStore, wired like main(). opts
+// adjust the config before the handlers are built.
+type testServer struct {
+	*httptest.Server
+	store *MemStore
+}
+
+func newTestServer(t *testing.T, opts ...func(*Config)) *testServer {
+	t.Helper()
+	cfg := Config{
+		MaxBodyBytes:      262144,
+		MaxBatchBodyBytes: 2097152,
+		MaxBatchItems:     100,
+		RateLimitRPM:      6000,
+		RateBurst:         1000,
+		RateKeyMode:       "ip",
+		AdminPassword:     testAdminPassword,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	store := NewMemStore()
+	dead := NewDeadLetterStore(store, 100, cfg.MaxBodyBytes, 0)
+	wq := NewWriteQueue(WriteQueueConfig{
+		Capacity:  1000,
+		Workers:   1,
+		BatchSize: 50,
+		BatchWait: 10 * time.Millisecond,
+	}, store, NewExecIndex(), nil, dead)
+	wq.Start()
+	t.Cleanup(func() { wq.Stop(5 * time.Second) })
+
+	mux := newMux(cfg, nil, store, wq, NewIngestor(wq, dead, false), NewRateLimiter(cfg.RateLimitRPM, cfg.RateBurst),
+		NewCache(CacheConfig{DefaultTTL: time.Minute}), NewAlerter(AlertConfig{}, store),
+		NewCleaner(CleanupConfig{}, store), dead)
+	srv := httptest.NewServer(securityHeaders(mux))
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, store: store}
+}
+
+// seed inserts a small mixed data set: two apps, several outcomes, a fork and
+// revision, hardware and duration fields.
+func (ts *testServer) seed(t *testing.T) {
+	t.Helper()
+	var rows []TelemetryOut
+	add := func(n int, p TelemetryOut) {
+		for i := 0; i < n; i++ {
+			p.RandomID = fmt.Sprintf("%s-%s-%d", p.NSAPP, p.Status, len(rows))
+			p.ExecutionID = p.RandomID
+			rows = append(rows, p)
+		}
+	}
+	base := TelemetryOut{
+		Type: "lxc", CTType: 1, DiskSize: 8, CoreCount: 2, RAMSize: 2048,
+		OsType: "debian", OsVersion: "12", PveVer: "8.2.4", Method: "default",
+		GPUVendor: "intel", GPUPassthrough: "igpu", CPUVendor: "amd",
+		RepoSource: "ProxmoxVE", RepoSlug: upstreamRepoSlug, ScriptVersion: "1.0",
+	}
+	ok := base
+	ok.NSAPP, ok.Status, ok.InstallDuration = "jellyfin", "success", 120
+	add(20, ok)
+	fail := base
+	fail.NSAPP, fail.Status, fail.ExitCode, fail.ErrorCategory = "jellyfin", "failed", 100, "apt"
+	fail.Error = "E: Unable to locate package jellyfin"
+	fail.ErrorFingerprint = errorFingerprint(fail.Error)
+	add(5, fail)
+	other := base
+	other.NSAPP, other.Status, other.InstallDuration, other.OsVersion = "homeassistant", "success", 300, "13"
+	add(10, other)
+	fork := ok
+	fork.RepoSlug, fork.ScriptVersion = "someone/ProxmoxVE", "1.1"
+	add(6, fork)
+	inst := base
+	inst.NSAPP, inst.Status = "jellyfin", "installing"
+	add(3, inst)
+	if err := ts.store.InsertTelemetryBatch(context.Background(), rows); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do sends a request and returns the status code and body.
+func (ts *testServer) do(t *testing.T, method, path, body string, header map[string]string) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, b
+}
+
+// getJSON fetches path, expects 200 and decodes the body into v.
+func (ts *testServer) getJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	code, body := ts.do(t, http.MethodGet, path, "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", path, code, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("GET %s: invalid JSON: %v", path, err)
+	}
+}
+
+// waitRows waits until the write queue has stored n rows.
+func (ts *testServer) waitRows(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ts.store.mu.RLock()
+		got := len(ts.store.rows)
+		ts.store.mu.RUnlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stored %d rows, want %d", got, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerIngest(t *testing.T) {
+	ts := newTestServer(t)
+
+	valid := `{"random_id":"r1","execution_id":"e1","type":"lxc","nsapp":"jellyfin","status":"installing","repo_source":"ProxmoxVE"}`
+	if code, body := ts.do(t, http.MethodPost, "/telemetry", valid, nil); code != http.StatusAccepted {
+		t.Fatalf("POST /telemetry = %d: %s", code, body)
+	}
+	// A repeated installing event is deduplicated by the write queue.
+	ts.do(t, http.MethodPost, "/telemetry", valid, nil)
+
+	code, body := ts.do(t, http.MethodPost, "/telemetry", `{"random_id":"r2","type":"bogus","nsapp":"x","status":"failed"}`, nil)
+	if code != http.StatusBadRequest || !strings.Contains(string(body), "type") {
+		t.Fatalf("invalid payload = %d: %s", code, body)
+	}
+	if code, _ := ts.do(t, http.MethodGet, "/telemetry", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /telemetry = %d, want 405", code)
+	}
+
+	batch := `[
+		{"random_id":"r3","execution_id":"e3","type":"lxc","nsapp":"jellyfin","status":"success","repo_source":"ProxmoxVE"},
+		{"random_id":"r4","type":"nope","nsapp":"x","status":"failed"},
+		{"random_id":"r5","execution_id":"e5","type":"vm","nsapp":"haos","status":"failed","exit_code":1,"repo_source":"ProxmoxVE"}
+	]`
+	code, body = ts.do(t, http.MethodPost, "/telemetry/batch", batch, nil)
+	if code != http.StatusOK {
+		t.Fatalf("POST /telemetry/batch = %d: %s", code, body)
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 2 || resp.Rejected != 1 || resp.Results[1].Status != "rejected" {
+		t.Fatalf("batch response = %+v", resp)
+	}
+
+	ts.waitRows(t, 3)
+	time.Sleep(50 * time.Millisecond)
+	ts.store.mu.RLock()
+	stored := len(ts.store.rows)
+	ts.store.mu.RUnlock()
+	if stored != 3 {
+		t.Errorf("stored %d rows, want 3 (duplicate installing event skipped)", stored)
+	}
+}
+
+func TestServerBatchRateLimit(t *testing.T) {
+	ts := newTestServer(t, func(cfg *Config) { cfg.RateLimitRPM, cfg.RateBurst = 3, 3 })
+
+	var items []string
+	for i := 0; i < 5; i++ {
+		items = append(items, fmt.Sprintf(`{"random_id":"r%d","type":"lxc","nsapp":"jellyfin","status":"success"}`, i))
+	}
+	code, body := ts.do(t, http.MethodPost, "/telemetry/batch", "["+strings.Join(items, ",")+"]", nil)
+	if code != http.StatusOK {
+		t.Fatalf("POST /telemetry/batch = %d: %s", code, body)
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 3 || resp.Rejected != 2 || resp.Results[4].Error != "rate limited" {
+		t.Fatalf("batch response = %+v, want 3 accepted and 2 rate limited", resp)
+	}
+
+	// With no tokens left the body is not even read: an invalid batch gets 429.
+	if code, body := ts.do(t, http.MethodPost, "/telemetry/batch", "not json", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("batch without tokens = %d: %s, want 429", code, body)
+	}
+}
+
+func TestServerValidateDryRun(t *testing.T) {
+	ts := newTestServer(t)
+
+	var out struct {
+		Valid      bool         `json:"valid"`
+		Normalized TelemetryOut `json:"normalized"`
+	}
+	code, body := ts.do(t, http.MethodPost, "/telemetry/validate",
+		`{"random_id":"r1","type":"lxc","nsapp":"jellyfin","status":"failed","exit_code":0,"gpu_vendor":"matrox"}`, nil)
+	if code != http.StatusOK {
+		t.Fatalf("POST /telemetry/validate = %d: %s", code, body)
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Valid || out.Normalized.Status != "success" || out.Normalized.GPUVendor != "unknown" {
+		t.Fatalf("validate = %s", body)
+	}
+
+	code, body = ts.do(t, http.MethodPost, "/telemetry/validate", `{"random_id":"r1","type":"x","nsapp":"a","status":"success"}`, nil)
+	if code != http.StatusBadRequest || !strings.Contains(string(body), `"field":"type"`) {
+		t.Fatalf("invalid dry run = %d: %s", code, body)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	ts.store.mu.RLock()
+	defer ts.store.mu.RUnlock()
+	if n := len(ts.store.rows); n != 0 {
+		t.Errorf("dry run stored %d rows", n)
+	}
+}
+
+func TestServerDashboardErrorsScripts(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed(t)
+
+	var dash struct {
+		TotalInstalls int               `json:"total_installs"`
+		SuccessCount  int               `json:"success_count"`
+		FailedCount   int               `json:"failed_count"`
+		Comparison    *PeriodComparison `json:"comparison"`
+	}
+	ts.getJSON(t, "/api/dashboard?days=7&compare=previous", &dash)
+	if dash.TotalInstalls != 44 || dash.SuccessCount != 36 || dash.FailedCount != 5 {
+		t.Errorf("dashboard totals = %+v", dash)
+	}
+	if dash.Comparison == nil || dash.Comparison.Metrics["total_installs"].Previous != 0 {
+		t.Errorf("dashboard comparison = %+v", dash.Comparison)
+	}
+
+	var errs struct {
+		TotalErrors int               `json:"total_errors"`
+		Comparison  *PeriodComparison `json:"comparison"`
+	}
+	ts.getJSON(t, "/api/errors?days=7&compare=previous", &errs)
+	if errs.TotalErrors != 5 || errs.Comparison == nil {
+		t.Errorf("errors = %+v", errs)
+	}
+
+	var scripts struct {
+		TotalInstalls int `json:"total_installs"`
+	}
+	ts.getJSON(t, "/api/scripts?days=7", &scripts)
+	if scripts.TotalInstalls == 0 {
+		t.Error("scripts: no installs")
+	}
+
+	var records map[string]interface{}
+	ts.getJSON(t, "/api/records?app=jellyfin&status=failed", &records)
+	if total, _ := records["total"].(float64); total != 5 {
+		t.Errorf("records total = %v, want 5", records["total"])
+	}
+}
+
+func TestServerAnalytics(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed(t)
+
+	var app AppDetail
+	ts.getJSON(t, "/api/apps/jellyfin?days=7", &app)
+	if app.TotalInstalls != 34 || app.SuccessCount != 26 || app.FailedCount != 5 {
+		t.Errorf("app detail = %d/%d/%d", app.TotalInstalls, app.SuccessCount, app.FailedCount)
+	}
+
+	var revs RevisionData
+	ts.getJSON(t, "/api/revisions?days=7&app=jellyfin", &revs)
+	if len(revs.Apps) != 1 || len(revs.Apps[0].Revisions) != 2 {
+		t.Errorf("revisions = %+v", revs.Apps)
+	}
+
+	var forks ForkData
+	ts.getJSON(t, "/api/forks?days=7", &forks)
+	if len(forks.Forks) != 1 || forks.Forks[0].Slug != "someone/ProxmoxVE" || forks.Forks[0].Installs != 6 {
+		t.Errorf("forks = %+v", forks.Forks)
+	}
+
+	// The remaining analytics endpoints must answer with JSON on the seeded data.
+	for _, path := range []string{
+		"/api/durations?days=7",
+		"/api/compat/pve?days=7",
+		"/api/compat/os?days=7&app=jellyfin",
+		"/api/methods?days=7",
+		"/api/retries?days=7",
+		"/api/resources?days=7",
+		"/api/hardware?days=7",
+		"/api/funnel?days=7",
+		"/api/errors/clusters?days=7",
+		"/api/repo-slugs?days=7",
+		"/api/exit-codes",
+		"/api/schema?version=2",
+		"/api/dashboard?days=1",
+	} {
+		var v interface{}
+		ts.getJSON(t, path, &v)
+	}
+
+	if code, _ := ts.do(t, http.MethodGet, "/api/compat/nope", "", nil); code != http.StatusBadRequest && code != http.StatusNotFound {
+		t.Errorf("unknown compat dimension = %d", code)
+	}
+}
+
+func TestServerDeadLetters(t *testing.T) {
+	ts := newTestServer(t)
+
+	dl := DeadLetter{
+		ID:    "dl-1",
+		Stage: deadLetterStageValidate,
+		Body:  `{"random_id":"r1","execution_id":"e1","type":"lxc","nsapp":"jellyfin","status":"success","repo_source":"ProxmoxVE"}`,
+	}
+	if err := ts.store.InsertDeadLetters(context.Background(), []DeadLetter{dl}); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := ts.do(t, http.MethodGet, "/api/admin/dead-letters", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("dead letters without password = %d, want 401", code)
+	}
+	admin := map[string]string{"X-Admin-Password": testAdminPassword}
+	code, body := ts.do(t, http.MethodGet, "/api/admin/dead-letters", "", admin)
+	if code != http.StatusOK || !strings.Contains(string(body), "dl-1") {
+		t.Fatalf("dead letters = %d: %s", code, body)
+	}
+
+	code, body = ts.do(t, http.MethodPost, "/api/admin/dead-letters/replay", `{"ids":["dl-1"]}`, admin)
+	if code != http.StatusOK || !strings.Contains(string(body), `"replayed":1`) {
+		t.Fatalf("replay = %d: %s", code, body)
+	}
+	ts.waitRows(t, 1)
+}
+
+func TestServerHealthAndMetrics(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed(t)
+
+	if code, body := ts.do(t, http.MethodGet, "/healthz", "", nil); code != http.StatusOK {
+		t.Fatalf("healthz = %d: %s", code, body)
+	}
+	code, body := ts.do(t, http.MethodGet, "/metrics", "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("metrics = %d", code)
+	}
+	text := string(body)
+	ingest := strings.Index(text, "telemetry_queue_length")
+	installs := strings.Index(text, "telemetry_installs_total")
+	if ingest < 0 || installs < 0 || ingest > installs {
+		t.Errorf("ingest metrics must come first:\n%s", text)
+	}
+	if !strings.Contains(text, "telemetry_store_up 1") {
+		t.Error("telemetry_store_up 1 missing")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ---------- Storage abstraction ----------
+// Store is the set of storage operations the service uses. CHClient is the
+// production implementation; MemStore is an embedded in-memory backend
+// (STORE_BACKEND=memory) that returns the same result shapes, so the
+// dashboard can run locally without a ClickHouse server.
+
+type Store interface {
+	Ping(ctx context.Context) error
+	Close() error
+
+	// Ingest
+	InsertTelemetry(ctx context.Context, p TelemetryOut) error
+	InsertTelemetryBatch(ctx context.Context, rows []TelemetryOut) error
+	HasTerminalExecutionIDs(ctx context.Context, eids []string) (map[string]bool, error)
+
+	// Dashboard & analysis
+	FetchDashboardData(ctx context.Context, days int, repoSource, repoSlug string) (*DashboardData, error)
+	FetchScriptStats(ctx context.Context, days int, repoSource string, knownScripts map[string]ScriptInfo) (*ScriptAnalysisData, error)
+	FetchErrorAnalysisData(ctx context.Context, days int, repoSource, repoSlug string) (*ErrorAnalysisData, error)
+	FetchRecordsPaginated(ctx context.Context, page, limit int,
+		status, app, osType, typeFilter, sortField, repoSource, repoSlug string, days int) ([]TelemetryRecord, int, error)
+	FetchRepoSlugs(ctx context.Context, days int, repoSource string) ([]RepoSlugCount, error)
+	FetchAppDetail(ctx context.Context, nsapp string, days int, repoSource, repoSlug string) (*AppDetail, error)
+	FetchDurationStats(ctx context.Context, days int, repoSource, repoSlug, by, app, typeFilter, osType string) (*DurationData, error)
+	FetchRevisionStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*RevisionData, error)
+	FetchErrorClusters(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*ErrorClusterData, error)
+	FetchPveMatrix(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error)
+	FetchOsMatrix(ctx context.Context, days int, repoSource, repoSlug, app string, limit int) (*CompatMatrix, error)
+	FetchHourlyStats(ctx context.Context, since time.Time, repoSource, repoSlug string) ([]HourlyStat, error)
+	FetchPreviousPeriod(ctx context.Context, days int, repoSource, repoSlug string) (*PeriodCounts, error)
+	FetchForkStats(ctx context.Context, days int, repoSource string) (*ForkData, error)
+	FetchMethodStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*MethodData, error)
+	FetchRetryStats(ctx context.Context, days int, repoSource, repoSlug, app string, window time.Duration) (*RetryData, error)
+	FetchResourceStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*ResourceData, error)
+	FetchHardwareStats(ctx context.Context, days int, repoSource, repoSlug, app string) (*HardwareData, error)
+	FetchFunnel(ctx context.Context, days int, repoSource, repoSlug, app string) (*FunnelData, error)
+	FetchAppFailureWindows(ctx context.Context, repoSource string, window time.Duration, baselineDays, minInstalls int) ([]AppFailureWindow, error)
+
+	// Cleanup & retention
+	FindStuckInstallations(ctx context.Context, stuckHours int) ([]StuckRecord, error)
+	MarkRecordAsUnknown(ctx context.Context, record StuckRecord, stuckHours int) error
+	GetStuckCount(ctx context.Context, stuckHours int) (int, error)
+	DeleteOldRecords(ctx context.Context, retentionDays int) error
+	RetentionStats(ctx context.Context, retentionDays int) (eligible int, oldestDate string, err error)
+
+	// Dead letters
+	InsertDeadLetters(ctx context.Context, rows []DeadLetter) error
+	FetchDeadLetters(ctx context.Context, stage, reason string, page, limit int) ([]DeadLetter, uint64, error)
+	FetchDeadLettersByID(ctx context.Context, ids []string) ([]DeadLetter, error)
+	FetchDeadLetterSummary(ctx context.Context, days int) ([]DeadLetterReason, error)
+	DeleteDeadLetters(ctx context.Context, ids []string) error
+}
+
+var _ Store = (*CHClient)(nil)
+var _ Store = (*MemStore)(nil)
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ---------- Structured validation errors ----------
+// validate() collects every field-level problem instead of stopping at the
+// first one. Rejections are returned to the client as RFC 7807 problem+json so
+// script authors can see why an event was not accepted.
+
+// FieldProblem is one rejected field. Rule is a fixed description of the
+// constraint (safe to use as a metrics label or dead-letter reason); Value is
+// the offending input as received (truncated).
+type FieldProblem struct {
+	Field string `json:"field"`
+	Value string `json:"value,omitempty"`
+	Rule  string `json:"rule"`
+}
+
+// ValidationError lists all problems found in one payload.
+type ValidationError struct {
+	Problems []FieldProblem `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		parts[i] = p.Field + ": " + p.Rule
+	}
+	return strings.Join(parts, "; ")
+}
+
+// add records a problem. Values are cut to 128 bytes so an oversized field does
+// not end up verbatim in the response.
+func (e *ValidationError) add(field, value, rule string) {
+	if len(value) > 128 {
+		value = value[:128] + "..."
+	}
+	e.Problems = append(e.Problems, FieldProblem{Field: field, Value: value, Rule: rule})
+}
+
+// err returns e if any problem was recorded, nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// fieldProblems extracts the field problems wrapped in err, if any.
+func fieldProblems(err error) []FieldProblem {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return ve.Problems
+	}
+	return nil
+}
+
+// problemDetail is an RFC 7807 problem document.
+type problemDetail struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Problems []FieldProblem `json:"problems,omitempty"`
+}
+
+// writeProblem writes an application/problem+json response.
+func writeProblem(w http.ResponseWriter, status int, title, detail string, problems []FieldProblem) {
+	typ := "about:blank"
+	if len(problems) > 0 {
+		typ = "/api/schema"
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problemDetail{
+		Type:     typ,
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Problems: problems,
+	})
+}
+
+// writeIngestError answers a failed Ingest with a problem document. Field
+// problems are included for validation rejects, the decoder message for
+// invalid JSON.
+func writeIngestError(w http.ResponseWriter, err error) {
+	code, msg := ingestHTTPError(err)
+	detail := ""
+	if errors.Is(err, errInvalidJSON) || errors.Is(err, errInvalidPayload) {
+		detail = err.Error()
+	}
+	writeProblem(w, code, msg, detail, fieldProblems(err))
+}
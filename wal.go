@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Disk-backed write-ahead log ----------
+// When WAL_DIR is set, every accepted payload is appended to an on-disk journal
+// before /telemetry returns 202. A feeder goroutine tails the journal into the
+// WriteQueue channel and workers acknowledge each record once it is persisted
+// in ClickHouse (or deliberately skipped/failed). Unacknowledged records are
+// replayed on the next start, so a crash, OOM kill or drain timeout no longer
+// loses accepted telemetry.
+//
+// Layout: the journal is split into append-only segments "<id>.wal" holding one
+// JSON record per line. Acks are appended to a sibling "<id>.ack" file as 8-byte
+// little-endian sequence numbers. A segment (and its ack file) is deleted once
+// it is no longer being written, the feeder has read past it, and every record
+// in it has been acknowledged.
+
+var (
+	errWALFull   = errors.New("wal full")
+	errWALClosed = errors.New("wal closed")
+)
+
+// walRecord is a single journaled payload.
+type walRecord struct {
+	Seq     uint64       `json:"seq"`
+	Attempt int          `json:"attempt,omitempty"`
+	Payload TelemetryOut `json:"payload"`
+}
+
+// walPos identifies a journaled record so a worker can acknowledge it.
+// The zero value means "not journaled".
+type walPos struct {
+	Seg uint64
+	Seq uint64
+}
+
+type walSegment struct {
+	id      uint64
+	size    int64           // committed bytes
+	entries int             // records in the segment
+	acked   int             // records acknowledged (or unreadable)
+	skip    map[uint64]bool // seqs acknowledged before the last restart
+	ackFile *os.File
+}
+
+// WAL is an append-only, segment-based journal backing the WriteQueue.
+type WAL struct {
+	dir         string
+	segmentSize int64
+	maxBytes    int64
+
+	mu       sync.Mutex
+	segments []*walSegment // oldest first; the last one is being written
+	active   *os.File
+	nextSeq  uint64
+	bytes    int64 // total bytes across all segments
+	unread   int   // records not yet handed to a worker
+	dirty    bool
+	closed   bool
+
+	// Feeder cursor
+	readSeg *walSegment
+	readOff int64
+	reader  *os.File
+	rbuf    *bufio.Reader
+
+	notify chan struct{}
+
+	stopSync chan struct{}
+	syncDone chan struct{}
+}
+
+// OpenWAL opens (or creates) the journal in dir and prepares every
+// unacknowledged record from a previous run for replay.
+func OpenWAL(dir string, segmentSize, maxBytes int64) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("wal mkdir: %w", err)
+	}
+	w := &WAL{
+		dir:         dir,
+		segmentSize: segmentSize,
+		maxBytes:    maxBytes,
+		nextSeq:     1,
+		notify:      make(chan struct{}, 1),
+		stopSync:    make(chan struct{}),
+		syncDone:    make(chan struct{}),
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		return nil, fmt.Errorf("wal list: %w", err)
+	}
+	var ids []uint64
+	for _, n := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(n), ".wal"), 10, 64)
+		if err != nil {
+			log.Printf("[WAL] ignoring unexpected file %s", n)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var lastID uint64
+	for _, id := range ids {
+		lastID = id
+		seg, maxSeq, err := w.loadSegment(id)
+		if err != nil {
+			return nil, err
+		}
+		if maxSeq >= w.nextSeq {
+			w.nextSeq = maxSeq + 1
+		}
+		if seg.acked >= seg.entries {
+			w.removeSegmentFiles(seg)
+			continue
+		}
+		w.segments = append(w.segments, seg)
+		w.bytes += seg.size
+		w.unread += seg.entries - seg.acked
+	}
+
+	if err := w.openSegment(lastID + 1); err != nil {
+		return nil, err
+	}
+	w.readSeg = w.segments[0]
+
+	if w.unread > 0 {
+		log.Printf("[WAL] replaying %d unacknowledged records from %d segments in %s", w.unread, len(w.segments)-1, dir)
+	} else {
+		log.Printf("[WAL] journal ready in %s", dir)
+	}
+
+	go w.syncLoop()
+	return w, nil
+}
+
+// loadSegment scans an existing segment, truncating a torn trailing record
+// left behind by a crash mid-write, and loads its ack file.
+func (w *WAL) loadSegment(id uint64) (*walSegment, uint64, error) {
+	seg := &walSegment{id: id, skip: make(map[uint64]bool)}
+
+	if b, err := os.ReadFile(w.ackPath(id)); err == nil {
+		for i := 0; i+8 <= len(b); i += 8 {
+			seg.skip[binary.LittleEndian.Uint64(b[i:])] = true
+		}
+	}
+
+	f, err := os.OpenFile(w.segPath(id), os.O_RDWR, 0o640)
+	if err != nil {
+		return nil, 0, fmt.Errorf("wal open segment %d: %w", id, err)
+	}
+	defer f.Close()
+
+	var maxSeq uint64
+	var off int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// Anything after the last newline is a torn write.
+			if len(line) > 0 {
+				log.Printf("[WAL] truncating torn record in segment %d at offset %d", id, off)
+				if terr := f.Truncate(off); terr != nil {
+					return nil, 0, fmt.Errorf("wal truncate segment %d: %w", id, terr)
+				}
+			}
+			break
+		}
+		off += int64(len(line))
+		seg.entries++
+
+		var rec walRecord
+		if jerr := json.Unmarshal(line, &rec); jerr != nil {
+			log.Printf("[WAL] skipping unreadable record in segment %d: %v", id, jerr)
+			seg.acked++
+			continue
+		}
+		if rec.Seq > maxSeq {
+			maxSeq = rec.Seq
+		}
+		if seg.skip[rec.Seq] {
+			seg.acked++
+		}
+	}
+	seg.size = off
+	return seg, maxSeq, nil
+}
+
+func (w *WAL) segPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d.wal", id))
+}
+
+func (w *WAL) ackPath(id uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d.ack", id))
+}
+
+// openSegment starts a new active segment. Caller holds mu (or is OpenWAL).
+func (w *WAL) openSegment(id uint64) error {
+	f, err := os.OpenFile(w.segPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("wal create segment %d: %w", id, err)
+	}
+	w.active = f
+	w.segments = append(w.segments, &walSegment{id: id})
+	return nil
+}
+
+func (w *WAL) activeSegment() *walSegment {
+	return w.segments[len(w.segments)-1]
+}
+
+// Append journals a payload and returns its position. Returns errWALFull when
+// the journal has reached its size limit.
+func (w *WAL) Append(attempt int, p TelemetryOut) (walPos, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return walPos{}, errWALClosed
+	}
+
+	seq := w.nextSeq
+	line, err := json.Marshal(walRecord{Seq: seq, Attempt: attempt, Payload: p})
+	if err != nil {
+		return walPos{}, err
+	}
+	line = append(line, '\n')
+	n := int64(len(line))
+
+	if w.bytes+n > w.maxBytes {
+		return walPos{}, errWALFull
+	}
+
+	seg := w.activeSegment()
+	if seg.entries > 0 && seg.size+n > w.segmentSize {
+		if err := w.active.Sync(); err != nil {
+			log.Printf("[WAL] sync segment %d: %v", seg.id, err)
+		}
+		w.active.Close()
+		if err := w.openSegment(seg.id + 1); err != nil {
+			return walPos{}, err
+		}
+		seg = w.activeSegment()
+	}
+
+	if _, err := w.active.Write(line); err != nil {
+		return walPos{}, fmt.Errorf("wal write: %w", err)
+	}
+	w.nextSeq++
+	seg.size += n
+	seg.entries++
+	w.bytes += n
+	w.unread++
+	w.dirty = true
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return walPos{Seg: seg.id, Seq: seq}, nil
+}
+
+// Next returns the next unread record, or false if the feeder has caught up
+// with the writer or the journal is closed.
+func (w *WAL) Next() (walRecord, walPos, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return walRecord{}, walPos{}, false
+	}
+
+	for {
+		seg := w.readSeg
+		if w.reader == nil {
+			f, err := os.Open(w.segPath(seg.id))
+			if err != nil {
+				log.Printf("[WAL] open segment %d for reading: %v", seg.id, err)
+				return walRecord{}, walPos{}, false
+			}
+			w.reader = f
+			w.rbuf = bufio.NewReader(f)
+			w.readOff = 0
+		}
+
+		if w.readOff < seg.size {
+			// Every byte below seg.size belongs to a complete record: writes
+			// happen under mu, so a full line is always available here.
+			line, err := w.rbuf.ReadBytes('\n')
+			w.readOff += int64(len(line))
+			if err != nil {
+				log.Printf("[WAL] read segment %d: %v", seg.id, err)
+				return walRecord{}, walPos{}, false
+			}
+			var rec walRecord
+			if json.Unmarshal(line, &rec) != nil || seg.skip[rec.Seq] {
+				continue // unreadable or acknowledged before restart (already counted)
+			}
+			w.unread--
+			return rec, walPos{Seg: seg.id, Seq: rec.Seq}, true
+		}
+
+		if seg == w.activeSegment() {
+			return walRecord{}, walPos{}, false
+		}
+
+		// Sealed segment fully read: move on and drop it if everything is acked.
+		w.reader.Close()
+		w.reader, w.rbuf = nil, nil
+		for i, s := range w.segments {
+			if s == seg {
+				w.readSeg = w.segments[i+1]
+				break
+			}
+		}
+		w.maybeRemove(seg)
+	}
+}
+
+// Ack marks a record as done. Acks are journaled so a restart does not replay
+// records that already reached ClickHouse. Acks after Close are dropped, so
+// those records are replayed.
+func (w *WAL) Ack(pos walPos) {
+	if pos.Seq == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+
+	var seg *walSegment
+	for _, s := range w.segments {
+		if s.id == pos.Seg {
+			seg = s
+			break
+		}
+	}
+	if seg == nil {
+		return
+	}
+	seg.acked++
+
+	if seg.ackFile == nil {
+		f, err := os.OpenFile(w.ackPath(seg.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			log.Printf("[WAL] open ack file for segment %d: %v", seg.id, err)
+		} else {
+			seg.ackFile = f
+		}
+	}
+	if seg.ackFile != nil {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], pos.Seq)
+		if _, err := seg.ackFile.Write(b[:]); err != nil {
+			log.Printf("[WAL] write ack for segment %d: %v", seg.id, err)
+		}
+		w.dirty = true
+	}
+
+	w.maybeRemove(seg)
+}
+
+// maybeRemove deletes a segment once it is sealed, fully read and fully
+// acknowledged. Caller holds mu.
+func (w *WAL) maybeRemove(seg *walSegment) {
+	if seg == w.activeSegment() || seg.id >= w.readSeg.id || seg.acked < seg.entries {
+		return
+	}
+	for i, s := range w.segments {
+		if s == seg {
+			w.segments = append(w.segments[:i], w.segments[i+1:]...)
+			break
+		}
+	}
+	w.bytes -= seg.size
+	w.removeSegmentFiles(seg)
+}
+
+func (w *WAL) removeSegmentFiles(seg *walSegment) {
+	if seg.ackFile != nil {
+		seg.ackFile.Close()
+		seg.ackFile = nil
+	}
+	if err := os.Remove(w.segPath(seg.id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[WAL] remove segment %d: %v", seg.id, err)
+	}
+	if err := os.Remove(w.ackPath(seg.id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[WAL] remove ack file %d: %v", seg.id, err)
+	}
+}
+
+// Unread returns the number of journaled records not yet handed to a worker.
+func (w *WAL) Unread() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.unread
+}
+
+// syncLoop fsyncs the journal once per second. A crash can therefore lose at
+// most the last second of accepted payloads instead of the whole queue.
+func (w *WAL) syncLoop() {
+	defer close(w.syncDone)
+	t := time.NewTicker(1 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stopSync:
+			return
+		case <-t.C:
+		}
+		w.mu.Lock()
+		if w.dirty {
+			w.sync()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// sync flushes the active segment and all open ack files. Caller holds mu.
+func (w *WAL) sync() {
+	if err := w.active.Sync(); err != nil {
+		log.Printf("[WAL] sync: %v", err)
+	}
+	for _, s := range w.segments {
+		if s.ackFile != nil {
+			_ = s.ackFile.Sync()
+		}
+	}
+	w.dirty = false
+}
+
+// Close stops the sync loop and flushes the journal to disk. Later Appends
+// fail and Acks are dropped; unacknowledged records stay on disk and are
+// replayed by the next OpenWAL.
+func (w *WAL) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stopSync)
+	<-w.syncDone
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sync()
+	w.active.Close()
+	if w.reader != nil {
+		w.reader.Close()
+		w.reader, w.rbuf = nil, nil
+	}
+	for _, s := range w.segments {
+		if s.ackFile != nil {
+			s.ackFile.Close()
+			s.ackFile = nil
+		}
+	}
+}
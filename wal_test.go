@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func walPayload(i int) TelemetryOut {
+	return TelemetryOut{RandomID: fmt.Sprintf("rec-%d", i), NSAPP: "jellyfin", Status: "success", Type: "lxc"}
+}
+
+// walFiles returns the base names of the files with the given extension in dir.
+func walFiles(t *testing.T, dir, ext string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, n := range names {
+		names[i] = filepath.Base(n)
+	}
+	return names
+}
+
+// drainWAL reads records until the feeder has caught up.
+func drainWAL(w *WAL) ([]walRecord, []walPos) {
+	var recs []walRecord
+	var pos []walPos
+	for {
+		rec, p, ok := w.Next()
+		if !ok {
+			return recs, pos
+		}
+		recs = append(recs, rec)
+		pos = append(pos, p)
+	}
+}
+
+func TestWALReplaysUnackedRecordsOnce(t *testing.T) {
+	dir := t.TempDir()
+	// A segment size of 1 byte seals every segment after one record.
+	w, err := OpenWAL(dir, 1, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if _, err := w.Append(0, walPayload(i)); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+	if n := len(walFiles(t, dir, ".wal")); n != 5 {
+		t.Fatalf("%d segments after 5 appends, want 5", n)
+	}
+
+	// Read and acknowledge the first two records, read the third without
+	// acknowledging it and leave the last two unread.
+	for i := 0; i < 3; i++ {
+		_, pos, ok := w.Next()
+		if !ok {
+			t.Fatalf("Next %d: no record", i)
+		}
+		if i < 2 {
+			w.Ack(pos)
+		}
+	}
+	if got := walFiles(t, dir, ".wal"); len(got) != 3 {
+		t.Fatalf("segments after acking 2 sealed ones = %v, want 3 left", got)
+	}
+	w.Close()
+
+	// Simulate a crash mid-write: a torn record at the end of the last segment.
+	segs := walFiles(t, dir, ".wal")
+	last := filepath.Join(dir, segs[len(segs)-1])
+	before, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"seq":6,"payload":{"random_id":"to`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	w, err = OpenWAL(dir, 1, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.Stat(last); err != nil || after.Size() != before.Size() {
+		t.Fatalf("torn record not truncated: size %d, want %d (%v)", after.Size(), before.Size(), err)
+	}
+	if n := w.Unread(); n != 3 {
+		t.Fatalf("Unread after reopen = %d, want 3", n)
+	}
+	recs, pos := drainWAL(w)
+	var ids []string
+	for _, r := range recs {
+		ids = append(ids, r.Payload.RandomID)
+	}
+	if fmt.Sprint(ids) != "[rec-3 rec-4 rec-5]" {
+		t.Fatalf("replayed %v, want [rec-3 rec-4 rec-5]", ids)
+	}
+
+	// New appends continue the sequence after the replayed records.
+	p, err := w.Append(0, walPayload(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Seq != 6 {
+		t.Errorf("seq after reopen = %d, want 6", p.Seq)
+	}
+	rec, p6, ok := w.Next()
+	if !ok || rec.Payload.RandomID != "rec-6" {
+		t.Fatalf("Next after reopen = %v, %v; want rec-6", rec.Payload.RandomID, ok)
+	}
+
+	for _, p := range append(pos, p6) {
+		w.Ack(p)
+	}
+	w.Close()
+
+	// Everything is acknowledged: nothing is replayed and only the new active
+	// segment is left on disk.
+	w, err = OpenWAL(dir, 1, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if recs, _ := drainWAL(w); len(recs) != 0 {
+		t.Fatalf("replayed %d acknowledged records", len(recs))
+	}
+	if got := walFiles(t, dir, ".wal"); len(got) != 1 {
+		t.Errorf("segments after acking everything = %v, want only the active one", got)
+	}
+	if got := walFiles(t, dir, ".ack"); len(got) != 0 {
+		t.Errorf("ack files of deleted segments left behind: %v", got)
+	}
+}
+
+func TestWALFull(t *testing.T) {
+	w, err := OpenWAL(t.TempDir(), 1<<20, 150) // room for one record
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := w.Append(0, walPayload(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Append(0, walPayload(2)); !errors.Is(err, errWALFull) {
+		t.Fatalf("Append over the size limit = %v, want errWALFull", err)
+	}
+	if n := w.Unread(); n != 1 {
+		t.Errorf("Unread = %d, want 1", n)
+	}
+}
+
+func TestWriteQueueSpill(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenWAL(dir, 1<<20, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wq := NewWriteQueue(WriteQueueConfig{Capacity: 1, Workers: 1, BatchSize: 1}, NewMemStore(), NewExecIndex(), w, nil)
+
+	if _, err := w.Append(0, walPayload(1)); err != nil {
+		t.Fatal(err)
+	}
+	rec, pos, _ := w.Next()
+
+	// A retry that does not fit into the channel is re-journaled with its
+	// attempt count and the original record is acknowledged.
+	wq.spill(0, WriteItem{Payload: rec.Payload, Attempt: 1, wal: pos})
+	again, pos2, ok := w.Next()
+	if !ok || again.Attempt != 1 || again.Payload.RandomID != "rec-1" {
+		t.Fatalf("spilled record = %+v, %v; want rec-1 with attempt 1", again, ok)
+	}
+	w.Close()
+
+	// After a restart only the re-journaled record is replayed.
+	w, err = OpenWAL(dir, 1<<20, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := drainWAL(w)
+	if len(recs) != 1 || recs[0].Seq != pos2.Seq || recs[0].Attempt != 1 {
+		t.Fatalf("replayed %+v, want only the spilled record", recs)
+	}
+
+	// When the journal cannot take the retry, it is kept in memory.
+	wq = NewWriteQueue(WriteQueueConfig{Capacity: 1, Workers: 1, BatchSize: 1}, NewMemStore(), NewExecIndex(), w, nil)
+	w.Close()
+	wq.spill(0, WriteItem{Payload: walPayload(2), Attempt: 2})
+	if n := wq.Len(); n != 1 {
+		t.Fatalf("Len after failed spill = %d, want 1", n)
+	}
+	if item, ok := wq.popRequeued(); !ok || item.Payload.RandomID != "rec-2" || item.Attempt != 2 {
+		t.Fatalf("requeued = %+v, %v; want rec-2 with attempt 2", item, ok)
+	}
+
+	// The feeder hands requeued retries out before reading new records.
+	w, err = OpenWAL(t.TempDir(), 1<<20, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wq = NewWriteQueue(WriteQueueConfig{Capacity: 1, Workers: 1, BatchSize: 1}, NewMemStore(), NewExecIndex(), w, nil)
+	if _, err := w.Append(0, walPayload(3)); err != nil {
+		t.Fatal(err)
+	}
+	wq.requeued = []WriteItem{{Payload: walPayload(2), Attempt: 2}}
+	go wq.feed()
+	defer wq.closeWAL()
+	for _, want := range []string{"rec-2", "rec-3"} {
+		select {
+		case item := <-wq.ch:
+			if item.Payload.RandomID != want {
+				t.Fatalf("feeder handed out %s, want %s", item.Payload.RandomID, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("feeder did not hand out %s", want)
+		}
+	}
+}